@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/mocksrc"
+)
+
+// Servidor de fuentes sintéticas: ADS_API_URL=http://localhost:8081/ads y
+// CRM_API_URL=http://localhost:8081/crm.
+func main() {
+	def := mocksrc.DefaultGenConfig()
+	var (
+		port      = flag.String("port", "8081", "puerto")
+		seed      = flag.Int64("seed", def.Seed, "semilla (mismos datos con la misma semilla)")
+		start     = flag.String("start", "", "primer día YYYY-MM-DD (default: hoy - days)")
+		days      = flag.Int("days", def.Days, "días generados")
+		channels  = flag.String("channels", strings.Join(def.Channels, ","), "canales separados por coma")
+		campaigns = flag.Int("campaigns", def.Campaigns, "campañas por canal")
+		clicks    = flag.Int("clicks", def.Clicks, "clicks medios por campaña y día")
+		leadRate  = flag.Float64("lead-rate", def.LeadRate, "click → lead (0 = sin leads)")
+		oppRate   = flag.Float64("opp-rate", def.OppRate, "lead → opportunity")
+		winRate   = flag.Float64("win-rate", def.WinRate, "opportunity → closed_won (0 = sin ventas)")
+		noise     = flag.Float64("noise", def.Noise, "ruido relativo, en [0, 0.9]")
+		badRows   = flag.Float64("bad-rows", def.BadRows, "fracción de filas inválidas")
+		noUTM     = flag.Float64("missing-utm", def.MissingUTM, "fracción de filas sin UTMs")
+
+		latency   = flag.Duration("latency", 0, "latencia fija por request")
+		jitter    = flag.Duration("jitter", 0, "latencia extra aleatoria")
+		errRate   = flag.Float64("error-rate", 0, "fracción de requests con 503")
+		truncRate = flag.Float64("truncate-rate", 0, "fracción de respuestas con JSON cortado")
+		failFirst = flag.Int("fail-first", 0, "los primeros N requests por endpoint dan 503")
+	)
+	flag.Parse()
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	if *noise < 0 || *noise > mocksrc.MaxNoise {
+		logger.Error("bad -noise", slog.String("err", "must be in [0, 0.9]"))
+		os.Exit(1)
+	}
+	for name, v := range map[string]float64{"lead-rate": *leadRate, "opp-rate": *oppRate, "win-rate": *winRate} {
+		if v < 0 || v > 1 {
+			logger.Error("bad -"+name, slog.String("err", "must be in [0, 1]"))
+			os.Exit(1)
+		}
+	}
+
+	cfg := def
+	cfg.Seed, cfg.Days, cfg.Campaigns, cfg.Clicks = *seed, *days, *campaigns, *clicks
+	cfg.LeadRate, cfg.OppRate, cfg.WinRate = *leadRate, *oppRate, *winRate
+	cfg.Noise, cfg.BadRows, cfg.MissingUTM = *noise, *badRows, *noUTM
+	cfg.Channels = nil
+	for _, c := range strings.Split(*channels, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cfg.Channels = append(cfg.Channels, c)
+		}
+	}
+	if *start != "" {
+		d, err := time.Parse("2006-01-02", *start)
+		if err != nil {
+			logger.Error("bad -start", slog.String("err", err.Error()))
+			os.Exit(1)
+		}
+		cfg.Start = d
+	}
+	data := mocksrc.Generate(cfg)
+	srv := mocksrc.NewServer(data, mocksrc.Faults{
+		Latency: *latency, Jitter: *jitter, ErrorRate: *errRate, TruncateRate: *truncRate, FailFirst: *failFirst,
+	}, *seed)
+
+	logger.Info("starting mock sources", slog.String("port", *port),
+		slog.Int("ads_rows", len(data.Ads)), slog.Int("crm_rows", len(data.CRM)))
+	hs := &http.Server{Addr: ":" + *port, Handler: srv.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	if err := hs.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Error("server error", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+}
@@ -1,31 +1,141 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/AngelCh415/ELT_GO/internal/alerts"
+	"github.com/AngelCh415/ELT_GO/internal/breaker"
+	"github.com/AngelCh415/ELT_GO/internal/budget"
 	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/export"
+	"github.com/AngelCh415/ELT_GO/internal/health"
 	"github.com/AngelCh415/ELT_GO/internal/httpx"
 	"github.com/AngelCh415/ELT_GO/internal/ingest"
 
 	"github.com/AngelCh415/ELT_GO/internal/metrics"
+	"github.com/AngelCh415/ELT_GO/internal/models"
 	"github.com/AngelCh415/ELT_GO/internal/store"
+	"github.com/AngelCh415/ELT_GO/internal/telemetry"
 )
 
 func main() {
 	cfg := config.FromEnv()
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.LogLevel}))
+	logger := slog.New(telemetry.LogHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.LogLevel})))
 	slog.SetDefault(logger)
+	if err := cfg.Validate(); err != nil {
+		logger.Error("config", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+
+	// siempre hay provider (IDs y traceparent); el exporter es opcional
+	var (
+		exp sdktrace.SpanExporter
+		err error
+	)
+	switch cfg.TraceExporter {
+	case "file":
+		exp, err = telemetry.NewFileExporter(cfg.TraceFile)
+	case "otlp":
+		exp, err = telemetry.NewOTLPExporter(cfg.OTLPEndpoint, cfg.HTTPTimeout)
+	case "":
+	default:
+		err = errors.New("unknown TRACE_EXPORTER " + cfg.TraceExporter)
+	}
+	if err != nil {
+		logger.Error("trace config", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+	tracer := telemetry.NewTracer(cfg.TraceServiceName, exp, cfg.TraceFlushInterval)
 
-	cl := ingest.NewHTTPClient(cfg.HTTPTimeout)
+	// un circuit breaker por endpoint para fuentes y sinks
+	bcl := breaker.NewClient(ingest.NewHTTPClient(cfg.HTTPTimeout))
+	bcl.Register("ads", cfg.AdsURL, cfg.BreakerFailures, cfg.BreakerCooldown)
+	bcl.Register("crm", cfg.CrmURL, cfg.BreakerFailures, cfg.BreakerCooldown)
+	bcl.Register("sink", cfg.SinkURL, cfg.BreakerFailures, cfg.BreakerCooldown)
+	if cfg.S3Endpoint != "" && cfg.S3Bucket != "" {
+		bcl.Register("s3", strings.TrimRight(cfg.S3Endpoint, "/")+"/"+cfg.S3Bucket, cfg.BreakerFailures, cfg.BreakerCooldown)
+	}
+	telemetry.GaugeVecFunc("circuit_breaker_state", "Circuit state by endpoint (0 closed, 1 half-open, 2 open).", "endpoint", func() map[string]float64 {
+		out := map[string]float64{}
+		for _, b := range bcl.Breakers() {
+			out[b.Name()] = float64(b.State())
+		}
+		return out
+	})
+	var cl ingest.HTTPClient = bcl
 	st := store.NewMemoryStore()
-	etl := ingest.NewETL(cl, st, logger, cfg)
-	mSvc := metrics.NewService(st)
+	sinks, err := export.FromConfig(cfg, cl)
+	if err != nil {
+		logger.Error("export config", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+	etl := ingest.NewETL(cl, st, logger, cfg, sinks...)
+	telemetry.GaugeFunc("store_daily_aggs", "DailyAgg rows in the store.", func() float64 { n, _, _ := st.Counts(); return float64(n) })
+	telemetry.GaugeFunc("store_opportunities", "Tracked opportunity lifecycles.", func() float64 { _, n, _ := st.Counts(); return float64(n) })
+	telemetry.GaugeFunc("store_seen_keys", "Idempotency keys seen by ingest.", func() float64 { _, _, n := st.Counts(); return float64(n) })
+	telemetry.GaugeFunc("export_ledger_pending", "Ledger entries waiting for a retry.", func() float64 {
+		return float64(len(st.Ledger(func(e models.LedgerEntry) bool { return e.Status == "retrying" || e.Status == "sending" })))
+	})
+	mSvc := metrics.NewService(st, cfg)
+	etl.OnComplete(func(ctx context.Context) {
+		n := mSvc.DetectAnomalies()
+		logger.Info("anomaly scan", slog.Int("anomalies", n))
+	})
+
+	bSvc := budget.NewService(st, cfg)
+	aSvc := alerts.NewService(cl, mSvc, logger, cfg)
+	etl.OnComplete(func(ctx context.Context) { aSvc.Evaluate(ctx, time.Now()) })
+
+	if cfg.ExportOnChange {
+		etl.OnComplete(func(ctx context.Context) {
+			if _, err := etl.ExportChanged(ctx); err != nil {
+				logger.Warn("export on change", slog.String("err", err.Error()))
+			}
+		})
+	}
 
-	r := httpx.NewRouter(logger, etl, mSvc)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// reintentos en segundo plano de las entregas fallidas del ledger
+	go etl.RunDispatcher(ctx, cfg.ExportDispatchInterval)
+
+	hSvc := health.NewRegistry(cfg.HealthCheckTimeout)
+	hSvc.Register("config", true, health.Config(cfg, etl.Sinks()))
+	// la frescura de la ingesta no es crítica: un pod recién levantado, o todos
+	// a la vez cuando una fuente se atrasa, seguirían sirviendo los datos que tienen
+	hSvc.Register("ingest_ads", false, health.Ingest(etl, "ads", cfg.HealthIngestMaxAge))
+	hSvc.Register("ingest_crm", false, health.Ingest(etl, "crm", cfg.HealthIngestMaxAge))
+	hSvc.Register("store", true, health.Store(st))
+	hSvc.Register("breakers", false, health.Breakers(bcl))
+	hSvc.Register("shutdown", true, func(context.Context) (string, error) {
+		if etl.Draining() {
+			return "", ingest.ErrShuttingDown
+		}
+		return "running", nil
+	})
+	if cfg.HealthSinkProbe {
+		hSvc.Register("sinks", false, health.Sinks(etl.Sinks()))
+	}
+
+	proxies, err := httpx.ParseProxies(cfg.TrustedProxies)
+	if err != nil {
+		logger.Error("access log config", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+	r := httpx.NewRouter(httpx.Deps{Log: logger, ETL: etl, Metrics: mSvc, Budgets: bSvc, Alerts: aSvc,
+		Access: httpx.AccessLog{Sample: &cfg.AccessLogSample, TrustedProxies: proxies}, Health: hSvc})
 
 	srv := &http.Server{
 		Addr:              ":" + cfg.Port,
@@ -34,8 +144,37 @@ func main() {
 	}
 
 	logger.Info("starting server", slog.String("port", cfg.Port))
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	select {
+	case err := <-errc:
 		logger.Error("server error", slog.String("err", err.Error()))
 		os.Exit(1)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// 1) no más jobs nuevos (/readyz pasa a 503) y espera a los que corren;
+	// al vencer el plazo se cancelan y los lotes quedan en el ledger
+	logger.Info("shutting down", slog.Duration("timeout", cfg.ShutdownTimeout))
+	dctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := etl.Shutdown(dctx); err != nil {
+		logger.Warn("jobs cancelled at shutdown deadline", slog.String("err", err.Error()))
+	}
+	if err := aSvc.Drain(dctx); err != nil {
+		logger.Warn("alerts not sent at shutdown deadline", slog.String("err", err.Error()))
+	}
+	// 2) el store es en memoria: no hay nada durable que volcar; las trazas sí
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		logger.Warn("trace flush", slog.String("err", err.Error()))
+	}
+	// 3) cierra el listener y espera las respuestas pendientes
+	sctx, cancelSrv := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelSrv()
+	if err := srv.Shutdown(sctx); err != nil {
+		logger.Error("server shutdown", slog.String("err", err.Error()))
+		os.Exit(1)
 	}
+	logger.Info("server stopped")
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/sinkrecv"
+	"github.com/AngelCh415/ELT_GO/pkg/signature"
+)
+
+// Receptor de referencia para SINK_URL. Usa las mismas claves que el emisor
+// (SINK_SECRET / SINK_KEY_ID / SINK_EXTRA_SECRETS) y guarda en RECEIVER_DIR.
+func main() {
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	keys := map[string]string{}
+	if s := os.Getenv("SINK_SECRET"); s != "" {
+		keys[envOr("SINK_KEY_ID", "default")] = s
+	}
+	var extra []string
+	for _, e := range strings.Split(os.Getenv("SINK_EXTRA_SECRETS"), ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			extra = append(extra, e)
+		}
+	}
+	more, err := signature.ParseKeys(extra)
+	if err != nil {
+		logger.Error("SINK_EXTRA_SECRETS", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+	for _, k := range more {
+		keys[k.ID] = k.Secret
+	}
+	if len(keys) == 0 {
+		logger.Error("SINK_SECRET required")
+		os.Exit(1)
+	}
+
+	tol, _ := strconv.Atoi(os.Getenv("RECEIVER_TOLERANCE_SECONDS"))
+	rv := sinkrecv.New(sinkrecv.Config{
+		Keys:      keys,
+		Dir:       envOr("RECEIVER_DIR", "sink-data"),
+		Tolerance: time.Duration(tol) * time.Second,
+	}, logger)
+
+	port := envOr("RECEIVER_PORT", "9090")
+	srv := &http.Server{Addr: ":" + port, Handler: rv.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	logger.Info("starting sink receiver", slog.String("port", port), slog.Int("keys", len(keys)))
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Error("server error", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+}
+
+func envOr(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
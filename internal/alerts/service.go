@@ -0,0 +1,503 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/metrics"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/retry"
+	"github.com/AngelCh415/ELT_GO/pkg/signature"
+)
+
+var ErrNotFound = errors.New("rule not found")
+
+// state es el estado de una regla entre evaluaciones.
+type state struct {
+	firing       bool
+	startsAt     time.Time
+	lastSent     time.Time // último firing notificado (dedupe)
+	lastResolved time.Time // para cooldown anti-flapping
+	last         models.AlertEvent
+}
+
+// Doer es el cliente con el que se envía el webhook (ingest.HTTPClient lo cumple).
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type Service struct {
+	c    Doer
+	mSvc *metrics.Service
+	log  *slog.Logger
+	cfg  config.Config
+
+	mu     sync.Mutex
+	seq    int
+	rules  map[string]models.AlertRule
+	states map[string]*state
+
+	// los envíos van por una cola con un solo worker: no frenan la ingesta
+	// que disparó Evaluate y firing/resolved llegan en orden
+	queue   chan queued
+	qmu     sync.Mutex
+	pending int
+	idle    chan struct{} // se cierra cuando pending vuelve a 0
+}
+
+type queued struct {
+	ctx context.Context
+	ev  models.AlertEvent
+}
+
+func NewService(c Doer, mSvc *metrics.Service, log *slog.Logger, cfg config.Config) *Service {
+	if cfg.AlertQueueSize <= 0 {
+		cfg.AlertQueueSize = 100
+	}
+	if cfg.AlertTimeout <= 0 {
+		cfg.AlertTimeout = 10 * time.Second
+	}
+	s := &Service{
+		c: c, mSvc: mSvc, log: log, cfg: cfg,
+		rules:  map[string]models.AlertRule{},
+		states: map[string]*state{},
+		queue:  make(chan queued, cfg.AlertQueueSize),
+	}
+	go s.sender()
+	return s
+}
+
+func (s *Service) Create(r models.AlertRule) (models.AlertRule, error) {
+	r, err := validate(r)
+	if err != nil {
+		return models.AlertRule{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	r.ID = "R-" + strconv.Itoa(s.seq)
+	s.rules[r.ID] = r
+	return r, nil
+}
+
+func (s *Service) Update(id string, r models.AlertRule) (models.AlertRule, error) {
+	r, err := validate(r)
+	if err != nil {
+		return models.AlertRule{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rules[id]; !ok {
+		return models.AlertRule{}, ErrNotFound
+	}
+	r.ID = id
+	s.rules[id] = r
+	delete(s.states, id) // la condición cambió: se reevalúa desde cero
+	return r, nil
+}
+
+func (s *Service) Get(id string) (models.AlertRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rules[id]
+	if !ok {
+		return models.AlertRule{}, ErrNotFound
+	}
+	return r, nil
+}
+
+func (s *Service) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rules[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.rules, id)
+	delete(s.states, id)
+	return nil
+}
+
+func (s *Service) List() []models.AlertRule {
+	s.mu.Lock()
+	out := make([]models.AlertRule, 0, len(s.rules))
+	for _, r := range s.rules {
+		out = append(out, r)
+	}
+	s.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return idNum(out[i].ID) < idNum(out[j].ID) })
+	return out
+}
+
+// Active devuelve las alertas que están disparadas ahora mismo.
+func (s *Service) Active() []models.AlertEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []models.AlertEvent{}
+	for _, st := range s.states {
+		if st.firing {
+			out = append(out, st.last)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return idNum(out[i].RuleID) < idNum(out[j].RuleID) })
+	return out
+}
+
+func validate(r models.AlertRule) (models.AlertRule, error) {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Type = strings.ToLower(strings.TrimSpace(r.Type))
+	r.Metric = strings.ToLower(strings.TrimSpace(r.Metric))
+	r.Source = strings.ToLower(strings.TrimSpace(r.Source))
+	if r.CooldownMinutes < 0 {
+		return r, errors.New("cooldown_minutes must be >= 0")
+	}
+	switch r.Type {
+	case "", "threshold":
+		r.Type = "threshold"
+		if _, ok := metricValue(r.Metric, totals{}); !ok {
+			return r, fmt.Errorf("unknown metric %q", r.Metric)
+		}
+		switch r.Op {
+		case ">", ">=", "<", "<=":
+		default:
+			return r, errors.New("op must be one of > >= < <=")
+		}
+		if r.WindowDays <= 0 {
+			r.WindowDays = 1
+		}
+		if r.WindowDays > 90 {
+			return r, errors.New("window_days must be <= 90")
+		}
+	case "no_data":
+		if r.Source != "ads" && r.Source != "crm" {
+			return r, errors.New("source must be ads or crm")
+		}
+	default:
+		return r, fmt.Errorf("unknown type %q (threshold|no_data)", r.Type)
+	}
+	if r.Name == "" {
+		r.Name = describe(r)
+	}
+	return r, nil
+}
+
+func describe(r models.AlertRule) string {
+	if r.Type == "no_data" {
+		return "no " + r.Source + " rows for yesterday"
+	}
+	scope := "all channels"
+	if r.Channel != "" {
+		scope = "channel " + r.Channel
+	}
+	if r.CampaignID != "" {
+		scope += " campaign " + r.CampaignID
+	}
+	return fmt.Sprintf("%s for %s over %d days %s %g", strings.ToUpper(r.Metric), scope, r.WindowDays, r.Op, r.Threshold)
+}
+
+// Evaluate revisa todas las reglas contra metrics.Service a la fecha now y
+// notifica al webhook los cambios firing/resolved.
+func (s *Service) Evaluate(ctx context.Context, now time.Time) {
+	for _, r := range s.List() {
+		if r.Disabled {
+			continue
+		}
+		ev, firing, err := s.check(r, now)
+		if err != nil {
+			s.log.Warn("alert eval failed", slog.String("rule", r.ID), slog.String("err", err.Error()))
+			continue
+		}
+		if send, ok := s.transition(r, ev, firing, now); ok {
+			s.enqueue(ctx, send)
+		}
+	}
+}
+
+// enqueue encola el evento; con la cola llena se descarta (y se loguea).
+func (s *Service) enqueue(ctx context.Context, ev models.AlertEvent) {
+	s.track(1)
+	select {
+	case s.queue <- queued{context.WithoutCancel(ctx), ev}:
+	default:
+		s.track(-1)
+		s.log.Warn("alert queue full, event dropped", slog.String("rule", ev.RuleID), slog.String("status", ev.Status))
+	}
+}
+
+func (s *Service) sender() {
+	for q := range s.queue {
+		ctx, cancel := context.WithTimeout(q.ctx, s.cfg.AlertTimeout)
+		s.notify(ctx, q.ev)
+		cancel()
+		s.track(-1)
+	}
+}
+
+func (s *Service) track(delta int) {
+	s.qmu.Lock()
+	defer s.qmu.Unlock()
+	if s.pending == 0 {
+		s.idle = make(chan struct{})
+	}
+	s.pending += delta
+	if s.pending == 0 {
+		close(s.idle)
+	}
+}
+
+// Drain espera a que se envíen los eventos encolados (o a que venza ctx).
+func (s *Service) Drain(ctx context.Context) error {
+	s.qmu.Lock()
+	idle := s.idle
+	if s.pending == 0 {
+		idle = nil
+	}
+	s.qmu.Unlock()
+	if idle == nil {
+		return nil
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// transition actualiza el estado de la regla y decide si hay que notificar.
+func (s *Service) transition(r models.AlertRule, ev models.AlertEvent, firing bool, now time.Time) (models.AlertEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rules[r.ID]; !ok {
+		return ev, false // borrada mientras se evaluaba
+	}
+	st, ok := s.states[r.ID]
+	if !ok {
+		st = &state{}
+		s.states[r.ID] = st
+	}
+
+	cooldown := time.Duration(r.CooldownMinutes) * time.Minute
+	if cooldown == 0 {
+		cooldown = s.cfg.AlertCooldown
+	}
+
+	switch {
+	case firing && !st.firing:
+		st.firing = true
+		st.startsAt = now
+		ev.StartsAt = now
+		st.last = ev
+		// cooldown: si se resolvió hace poco no volvemos a avisar (flapping)
+		if !st.lastResolved.IsZero() && now.Sub(st.lastResolved) < cooldown {
+			return ev, false
+		}
+		st.lastSent = now
+		return ev, true
+	case firing && st.firing:
+		ev.StartsAt = st.startsAt
+		st.last = ev
+		if st.lastSent.Before(st.startsAt) {
+			// episodio silenciado por el cooldown: se avisa recién cuando vence
+			if now.Sub(st.lastResolved) < cooldown {
+				return ev, false
+			}
+		} else if now.Sub(st.lastSent) < s.cfg.AlertDedupeWindow {
+			// dedupe: mientras siga disparada solo se recuerda cada ALERT_DEDUPE_WINDOW
+			return ev, false
+		}
+		st.lastSent = now
+		return ev, true
+	case !firing && st.firing:
+		st.firing = false
+		st.lastResolved = now
+		ev.StartsAt = st.startsAt
+		ev.Status = "resolved"
+		st.last = ev
+		// solo avisamos el resolved si el firing llegó a notificarse
+		return ev, !st.lastSent.Before(st.startsAt)
+	}
+	return ev, false
+}
+
+func (s *Service) check(r models.AlertRule, now time.Time) (models.AlertEvent, bool, error) {
+	ev := models.AlertEvent{
+		RuleID:      r.ID,
+		RuleName:    r.Name,
+		Status:      "firing",
+		Metric:      r.Metric,
+		Channel:     r.Channel,
+		CampaignID:  r.CampaignID,
+		Threshold:   r.Threshold,
+		EvaluatedAt: now,
+	}
+	yesterday := dayUTC(now).AddDate(0, 0, -1)
+
+	if r.Type == "no_data" {
+		t, err := s.totals(r, yesterday, yesterday)
+		if err != nil {
+			return ev, false, err
+		}
+		var n float64
+		if r.Source == "ads" {
+			n = float64(t.rowsAds)
+		} else {
+			n = float64(t.Leads)
+		}
+		ev.Value = n
+		ev.Message = fmt.Sprintf("%s: %g %s rows on %s", r.Name, n, r.Source, yesterday.Format("2006-01-02"))
+		return ev, n == 0, nil
+	}
+
+	// ventana de días completos que termina ayer
+	from := yesterday.AddDate(0, 0, -(r.WindowDays - 1))
+	t, err := s.totals(r, from, yesterday)
+	if err != nil {
+		return ev, false, err
+	}
+	v, _ := metricValue(r.Metric, t)
+	ev.Value = round2(v)
+	ev.Message = fmt.Sprintf("%s: value %g (%s..%s)", r.Name, ev.Value, from.Format("2006-01-02"), yesterday.Format("2006-01-02"))
+	return ev, compare(v, r.Op, r.Threshold), nil
+}
+
+type totals struct {
+	Clicks, Impressions, Leads, Opportunities, ClosedWon int
+	Cost, Revenue                                        float64
+	rowsAds                                              int
+}
+
+// totals suma las filas de metrics.Service (paginando) para el alcance de la regla.
+func (s *Service) totals(r models.AlertRule, from, to time.Time) (totals, error) {
+	var t totals
+	const page = 1000
+	for offset := 0; ; offset += page {
+		v := url.Values{}
+		v.Set("from", from.Format("2006-01-02"))
+		v.Set("to", to.Format("2006-01-02"))
+		v.Set("channel", r.Channel)
+		v.Set("limit", strconv.Itoa(page))
+		v.Set("offset", strconv.Itoa(offset))
+		rows, err := s.mSvc.QueryChannel(v)
+		if err != nil {
+			return t, err
+		}
+		for _, m := range rows {
+			if r.CampaignID != "" && !strings.EqualFold(m.CampaignID, r.CampaignID) {
+				continue
+			}
+			t.Clicks += m.Clicks
+			t.Impressions += m.Impressions
+			t.Leads += m.Leads
+			t.Opportunities += m.Opportunities
+			t.ClosedWon += m.ClosedWon
+			t.Cost += m.Cost
+			t.Revenue += m.Revenue
+			if m.Clicks > 0 || m.Impressions > 0 || m.Cost > 0 {
+				t.rowsAds++
+			}
+		}
+		if len(rows) < page {
+			return t, nil
+		}
+	}
+}
+
+func metricValue(metric string, t totals) (float64, bool) {
+	switch metric {
+	case "clicks":
+		return float64(t.Clicks), true
+	case "impressions":
+		return float64(t.Impressions), true
+	case "cost":
+		return t.Cost, true
+	case "leads":
+		return float64(t.Leads), true
+	case "opportunities":
+		return float64(t.Opportunities), true
+	case "closed_won":
+		return float64(t.ClosedWon), true
+	case "revenue":
+		return t.Revenue, true
+	case "cpc":
+		return safeDiv(t.Cost, float64(t.Clicks)), true
+	case "cpa":
+		return safeDiv(t.Cost, float64(t.Leads)), true
+	case "roas":
+		return safeDiv(t.Revenue, t.Cost), true
+	case "cvr_lead_to_opp":
+		return safeDiv(float64(t.Opportunities), float64(t.Leads)), true
+	case "cvr_opp_to_won":
+		return safeDiv(float64(t.ClosedWon), float64(t.Opportunities)), true
+	}
+	return 0, false
+}
+
+func compare(v float64, op string, th float64) bool {
+	switch op {
+	case ">":
+		return v > th
+	case ">=":
+		return v >= th
+	case "<":
+		return v < th
+	case "<=":
+		return v <= th
+	}
+	return false
+}
+
+// notify hace POST del evento firmado igual que el export (pkg/signature).
+func (s *Service) notify(ctx context.Context, ev models.AlertEvent) {
+	if s.cfg.AlertWebhookURL == "" {
+		s.log.Info("alert", slog.String("rule", ev.RuleID), slog.String("status", ev.Status), slog.String("msg", ev.Message))
+		return
+	}
+	if s.cfg.AlertWebhookSecret == "" {
+		s.log.Error("alert webhook secret not set, event not sent", slog.String("rule", ev.RuleID), slog.String("status", ev.Status))
+		return
+	}
+	b, _ := json.Marshal(ev)
+	keys := []signature.Key{{ID: s.cfg.AlertWebhookKeyID, Secret: s.cfg.AlertWebhookSecret}}
+	err := s.cfg.RetryPolicy("alerts").Do(ctx, func(ctx context.Context, _ int) error {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.AlertWebhookURL, bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		signature.SetHeaders(req.Header, keys, time.Now(), b)
+		resp, err := s.c.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return retry.FromResponse(resp)
+	})
+	if err != nil {
+		s.log.Warn("alert webhook failed", slog.String("rule", ev.RuleID), slog.String("err", err.Error()))
+	}
+}
+
+func idNum(id string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(id, "R-"))
+	return n
+}
+func safeDiv(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+func dayUTC(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+func round2(f float64) float64 { return float64(int64(f*100+0.5)) / 100 }
@@ -0,0 +1,202 @@
+// Package breaker corta las llamadas a un endpoint caído: tras N fallas
+// seguidas el circuito se abre y los requests fallan al instante hasta que
+// pasa el cooldown; entonces un request de prueba (half-open) decide si se
+// cierra o vuelve a abrirse.
+package breaker
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/retry"
+	"github.com/AngelCh415/ELT_GO/internal/telemetry"
+)
+
+type State int
+
+const (
+	Closed State = iota
+	HalfOpen
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// OpenError es el fallo inmediato con el circuito abierto; no se reintenta.
+type OpenError struct {
+	Endpoint string
+	Until    time.Time
+	Failures int
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker %s open until %s after %d consecutive failures",
+		e.Endpoint, e.Until.UTC().Format(time.RFC3339), e.Failures)
+}
+
+// Breaker es el circuito de un endpoint.
+type Breaker struct {
+	name      string
+	threshold int           // fallas seguidas que abren el circuito
+	cooldown  time.Duration // tiempo abierto antes del half-open
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool // hay un request de prueba en curso (half-open)
+}
+
+func New(name string, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{name: name, threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+func (b *Breaker) Name() string { return b.name }
+
+// State devuelve el estado; un circuito abierto con el cooldown vencido se
+// informa como half-open.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && !b.now().Before(b.openedAt.Add(b.cooldown)) {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// allow reserva el paso de un request o devuelve *OpenError.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open {
+		until := b.openedAt.Add(b.cooldown)
+		if b.now().Before(until) {
+			return &OpenError{Endpoint: b.name, Until: until, Failures: b.failures}
+		}
+		b.setState(HalfOpen)
+	}
+	if b.state == HalfOpen {
+		if b.probing {
+			return &OpenError{Endpoint: b.name, Until: b.now(), Failures: b.failures}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *Breaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if ok {
+		b.failures = 0
+		b.setState(Closed)
+		return
+	}
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setState(Open)
+	}
+}
+
+func (b *Breaker) setState(s State) {
+	if b.state != s {
+		b.state = s
+		telemetry.BreakerTransitions.WithLabelValues(b.name, s.String()).Inc()
+	}
+}
+
+// Doer es el cliente que envuelve Client (ingest.HTTPClient lo cumple).
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client pasa cada request por el breaker del endpoint registrado con el
+// prefijo de URL más largo; los que no coinciden con ninguno pasan directo.
+type Client struct {
+	next Doer
+
+	mu        sync.RWMutex
+	endpoints []endpoint
+}
+
+type endpoint struct {
+	prefix string
+	b      *Breaker
+}
+
+func NewClient(next Doer) *Client { return &Client{next: next} }
+
+// Register crea el breaker de name para las URLs que empiezan con url.
+// threshold <= 0 no registra nada (breaker deshabilitado).
+func (c *Client) Register(name, url string, threshold int, cooldown time.Duration) {
+	if threshold <= 0 || url == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.endpoints = append(c.endpoints, endpoint{strings.TrimRight(url, "/"), New(name, threshold, cooldown)})
+	sort.SliceStable(c.endpoints, func(i, j int) bool { return len(c.endpoints[i].prefix) > len(c.endpoints[j].prefix) })
+}
+
+// Breakers devuelve los breakers registrados ordenados por nombre.
+func (c *Client) Breakers() []*Breaker {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]*Breaker, len(c.endpoints))
+	for i, e := range c.endpoints {
+		out[i] = e.b
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
+
+func (c *Client) match(url string) *Breaker {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, e := range c.endpoints {
+		if url == e.prefix || strings.HasPrefix(url, e.prefix+"/") || strings.HasPrefix(url, e.prefix+"?") {
+			return e.b
+		}
+	}
+	return nil
+}
+
+// Do cuenta como falla los errores de red y las respuestas 5xx o 429; una
+// cancelación del llamador no cuenta.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	b := c.match(req.URL.String())
+	if b == nil {
+		return c.next.Do(req)
+	}
+	if err := b.allow(); err != nil {
+		telemetry.BreakerRejections.WithLabelValues(b.name).Inc()
+		return nil, retry.Permanent(err)
+	}
+	resp, err := c.next.Do(req)
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+	case err != nil:
+		b.record(false)
+	default:
+		b.record(resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests)
+	}
+	return resp, err
+}
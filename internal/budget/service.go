@@ -0,0 +1,274 @@
+package budget
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+)
+
+var ErrNotFound = errors.New("budget not found")
+
+type Service struct {
+	st  *store.MemoryStore
+	cfg config.Config
+
+	mu      sync.RWMutex
+	seq     int
+	budgets map[string]models.Budget
+	now     func() time.Time
+}
+
+func NewService(st *store.MemoryStore, cfg config.Config) *Service {
+	return &Service{st: st, cfg: cfg, budgets: map[string]models.Budget{}, now: time.Now}
+}
+
+func (s *Service) Create(b models.Budget) (models.Budget, error) {
+	b, err := normalize(b)
+	if err != nil {
+		return models.Budget{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	b.ID = "B-" + strconv.Itoa(s.seq)
+	s.budgets[b.ID] = b
+	return b, nil
+}
+
+func (s *Service) Update(id string, b models.Budget) (models.Budget, error) {
+	b, err := normalize(b)
+	if err != nil {
+		return models.Budget{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.budgets[id]; !ok {
+		return models.Budget{}, ErrNotFound
+	}
+	b.ID = id
+	s.budgets[id] = b
+	return b, nil
+}
+
+func (s *Service) Get(id string) (models.Budget, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.budgets[id]
+	if !ok {
+		return models.Budget{}, ErrNotFound
+	}
+	return b, nil
+}
+
+func (s *Service) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.budgets[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.budgets, id)
+	return nil
+}
+
+func (s *Service) List() []models.Budget {
+	s.mu.RLock()
+	out := make([]models.Budget, 0, len(s.budgets))
+	for _, b := range s.budgets {
+		out = append(out, b)
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return idNum(out[i].ID) < idNum(out[j].ID) })
+	return out
+}
+
+// normalize valida el presupuesto y deriva Start/End para los mensuales.
+func normalize(b models.Budget) (models.Budget, error) {
+	b.CampaignID = strings.TrimSpace(b.CampaignID)
+	b.Channel = strings.TrimSpace(b.Channel)
+	if b.CampaignID == "" && b.Channel == "" {
+		return b, errors.New("campaign_id or channel required")
+	}
+	if b.Amount <= 0 {
+		return b, errors.New("amount must be > 0")
+	}
+	if b.Threshold < 0 {
+		return b, errors.New("threshold must be >= 0")
+	}
+	if len(b.WeekdayWeights) != 0 {
+		if len(b.WeekdayWeights) != 7 {
+			return b, errors.New("weekday_weights needs 7 values (sunday..saturday)")
+		}
+		var sum float64
+		for _, w := range b.WeekdayWeights {
+			if w < 0 {
+				return b, errors.New("weekday_weights must be >= 0")
+			}
+			sum += w
+		}
+		if sum == 0 {
+			return b, errors.New("weekday_weights cannot all be zero")
+		}
+	}
+
+	switch b.Period {
+	case "", "monthly":
+		b.Period = "monthly"
+		m, err := time.Parse("2006-01", b.Month)
+		if err != nil {
+			return b, errors.New("month required (YYYY-MM)")
+		}
+		b.Start = m.Format("2006-01-02")
+		b.End = m.AddDate(0, 1, -1).Format("2006-01-02")
+	case "flight":
+		b.Month = ""
+		start, err1 := time.Parse("2006-01-02", b.Start)
+		end, err2 := time.Parse("2006-01-02", b.End)
+		if err1 != nil || err2 != nil {
+			return b, errors.New("start and end required (YYYY-MM-DD)")
+		}
+		if end.Before(start) {
+			return b, errors.New("end before start")
+		}
+	default:
+		return b, fmt.Errorf("unknown period %q (monthly|flight)", b.Period)
+	}
+	return b, nil
+}
+
+// Pacing calcula el avance de gasto de cada presupuesto a la fecha as_of
+// (por defecto hoy). Filtros opcionales: campaign_id, channel, status.
+func (s *Service) Pacing(v url.Values) ([]models.Pacing, error) {
+	asOf := day(s.now())
+	if q := v.Get("as_of"); q != "" {
+		t, err := time.Parse("2006-01-02", q)
+		if err != nil {
+			return nil, errors.New("bad as_of (YYYY-MM-DD)")
+		}
+		asOf = t
+	}
+	campaign := norm(v.Get("campaign_id"))
+	channel := norm(v.Get("channel"))
+	status := norm(v.Get("status"))
+
+	out := []models.Pacing{}
+	for _, b := range s.List() {
+		if campaign != "" && norm(b.CampaignID) != campaign {
+			continue
+		}
+		if channel != "" && norm(b.Channel) != channel {
+			continue
+		}
+		p := s.pace(b, asOf)
+		if status != "" && p.Status != status {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (s *Service) pace(b models.Budget, asOf time.Time) models.Pacing {
+	start, _ := time.Parse("2006-01-02", b.Start)
+	end, _ := time.Parse("2006-01-02", b.End)
+	p := models.Pacing{
+		BudgetID:   b.ID,
+		CampaignID: b.CampaignID,
+		Channel:    b.Channel,
+		Start:      b.Start,
+		End:        b.End,
+		AsOf:       asOf.Format("2006-01-02"),
+		Amount:     b.Amount,
+	}
+	if asOf.Before(start) {
+		p.Status = "not_started"
+		return p
+	}
+	cut := asOf
+	if cut.After(end) {
+		cut = end
+	}
+
+	for _, a := range s.st.Query(start, cut, func(a models.DailyAgg) bool {
+		if b.CampaignID != "" && norm(a.Key.CampaignID) != norm(b.CampaignID) {
+			return false
+		}
+		if b.Channel != "" && norm(a.Key.Channel) != norm(b.Channel) {
+			return false
+		}
+		return true
+	}) {
+		p.SpentToDate += a.Cost
+	}
+
+	weights := b.WeekdayWeights
+	if weightBetween(weights, start, end) == 0 {
+		weights = nil // el flight cae solo en días de peso 0: lineal
+	}
+	total := weightBetween(weights, start, end)
+	elapsed := weightBetween(weights, start, cut)
+	p.ExpectedToDate = b.Amount * elapsed / total
+	if p.ExpectedToDate > 0 {
+		p.PacingRatio = round3(p.SpentToDate / p.ExpectedToDate)
+	}
+	if elapsed > 0 {
+		// proyección al ritmo actual: gasto / fracción transcurrida
+		p.ProjectedSpend = p.SpentToDate * total / elapsed
+	}
+	p.Deviation = round3((p.ProjectedSpend - b.Amount) / b.Amount)
+
+	th := b.Threshold
+	if th == 0 {
+		th = s.cfg.BudgetPacingThreshold
+	}
+	switch {
+	case p.Deviation > th:
+		p.Status = "over"
+	case p.Deviation < -th:
+		p.Status = "under"
+	case asOf.After(end):
+		p.Status = "ended"
+	default:
+		p.Status = "on_track"
+	}
+
+	p.SpentToDate = round2(p.SpentToDate)
+	p.ExpectedToDate = round2(p.ExpectedToDate)
+	p.ProjectedSpend = round2(p.ProjectedSpend)
+	return p
+}
+
+// weightBetween suma el peso de los días [from, to]; sin pesos cada día vale 1.
+func weightBetween(weights []float64, from, to time.Time) float64 {
+	var w float64
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if len(weights) == 7 {
+			w += weights[d.Weekday()]
+		} else {
+			w++
+		}
+	}
+	return w
+}
+
+func idNum(id string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(id, "B-"))
+	return n
+}
+
+func norm(s string) string { return strings.ToLower(strings.TrimSpace(s)) }
+func day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+func round2(f float64) float64 { return math.Round(f*100) / 100 }
+func round3(f float64) float64 { return math.Round(f*1000) / 1000 }
@@ -1,19 +1,141 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/retry"
+	"github.com/AngelCh415/ELT_GO/pkg/signature"
 )
 
 type Config struct {
-	AdsURL      string
-	CrmURL      string
-	SinkURL     string
-	SinkSecret  string
-	Port        string
-	HTTPTimeout time.Duration
-	LogLevel    slog.Level
+	AdsURL     string
+	CrmURL     string
+	SinkURL    string
+	SinkSecret string
+	// id de SinkSecret en X-Key-Id y claves extra ("id:secret") que también
+	// firman mientras dura una rotación
+	SinkKeyID        string
+	SinkExtraSecrets []string
+	// límites por POST al sink http; por encima se parte en chunks + manifiesto (0 = sin límite)
+	SinkMaxRows  int
+	SinkMaxBytes int
+	Port         string
+	HTTPTimeout  time.Duration
+	LogLevel     slog.Level
+
+	// detección de anomalías sobre DailyAgg
+	AnomalyMethod      string // "zscore" (media/desv. estándar) o "mad" (mediana/MAD)
+	AnomalyWindow      int
+	AnomalySensitivity float64
+
+	// desviación relativa del gasto proyectado para marcar over/under
+	BudgetPacingThreshold float64
+
+	// alertas: webhook firmado con HMAC, dedupe y cooldown
+	AlertWebhookURL    string
+	AlertWebhookSecret string
+	AlertWebhookKeyID  string
+	AlertDedupeWindow  time.Duration
+	AlertCooldown      time.Duration
+	AlertQueueSize     int           // eventos pendientes de envío; si se llena se descartan
+	AlertTimeout       time.Duration // por envío, reintentos incluidos
+
+	// sinks de exportación: "kind[:format]" (http | file | s3; json | ndjson | csv [.gz])
+	ExportSinks []string
+	ExportDir   string
+	S3Endpoint  string
+	S3Bucket    string
+	S3Prefix    string
+	S3Region    string
+	S3AccessKey string
+	S3SecretKey string
+
+	// ledger de exportación: reintentos con backoff exponencial hasta ExportMaxAttempts
+	ExportRetryBase        time.Duration
+	ExportRetryMax         time.Duration
+	ExportMaxAttempts      int
+	ExportDispatchInterval time.Duration
+	// reexporta tras cada ingesta los días ya exportados que cambiaron
+	ExportOnChange bool
+
+	// jobs de export y entradas terminadas del ledger que se conservan (las
+	// más viejas se descartan; 0 = sin tope)
+	ExportJobHistory    int
+	ExportLedgerHistory int
+
+	// trazas: TraceExporter "" (sin exportar) | "file" | "otlp"
+	TraceExporter      string
+	TraceFile          string
+	OTLPEndpoint       string
+	TraceServiceName   string
+	TraceFlushInterval time.Duration
+
+	// log de acceso: fracción de requests exitosos logueados y proxies de
+	// confianza para X-Forwarded-For (CIDR o IP)
+	AccessLogSample float64
+	TrustedProxies  []string
+
+	// readiness: antigüedad máxima de la última ingesta por fuente (0 = sin
+	// límite), timeout por check y probe opcional de los sinks
+	HealthIngestMaxAge time.Duration
+	HealthCheckTimeout time.Duration
+	HealthSinkProbe    bool
+
+	// plazo para que terminen ingestas y exports en curso al recibir SIGTERM
+	ShutdownTimeout time.Duration
+
+	// reintentos de llamadas salientes por destino ("ads", "crm", "sink",
+	// "alerts"); ver RetryFor
+	Retry map[string]RetryConfig
+
+	// circuit breaker por endpoint (ADS, CRM, sinks): fallas seguidas que lo
+	// abren (0 = deshabilitado) y tiempo abierto antes de probar de nuevo
+	BreakerFailures int
+	BreakerCooldown time.Duration
+
+	// ingesta: workers para normalizar (1 = secuencial) y filas por lote al
+	// escribir en el store (cada lote toma el lock una vez)
+	IngestWorkers   int
+	IngestBatchSize int
+	// guarda las fuentes que se descargaron bien aunque otra falle
+	IngestPartialCommit bool
+}
+
+// RetryConfig es la política de reintentos de un destino.
+type RetryConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// defaultRetry: las fuentes reintentan dentro de la ingesta; sink y alertas
+// no, porque ya los reintenta el ledger (o se reevalúan en la siguiente corrida).
+var defaultRetry = map[string]RetryConfig{
+	"ads":    {MaxAttempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second},
+	"crm":    {MaxAttempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second},
+	"sink":   {MaxAttempts: 1, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second},
+	"alerts": {MaxAttempts: 1, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second},
+}
+
+// RetryFor devuelve la política del destino, o la de defecto si no se configuró.
+func (c Config) RetryFor(target string) RetryConfig {
+	if r, ok := c.Retry[target]; ok {
+		return r
+	}
+	return defaultRetry[target]
+}
+
+// RetryPolicy es la política de reintentos del destino lista para usar; es
+// el único lugar que traduce RetryConfig a retry.Policy.
+func (c Config) RetryPolicy(target string) retry.Policy {
+	r := c.RetryFor(target)
+	return retry.Policy{MaxAttempts: r.MaxAttempts, BaseDelay: r.BaseDelay, MaxDelay: r.MaxDelay}
 }
 
 func FromEnv() Config {
@@ -28,14 +150,113 @@ func FromEnv() Config {
 		lvl = slog.LevelDebug
 	}
 	return Config{
-		AdsURL:      os.Getenv("ADS_API_URL"),
-		CrmURL:      os.Getenv("CRM_API_URL"),
-		SinkURL:     os.Getenv("SINK_URL"),
-		SinkSecret:  os.Getenv("SINK_SECRET"),
+		AdsURL:     os.Getenv("ADS_API_URL"),
+		CrmURL:     os.Getenv("CRM_API_URL"),
+		SinkURL:    os.Getenv("SINK_URL"),
+		SinkSecret: os.Getenv("SINK_SECRET"),
+
+		SinkKeyID:        envOr("SINK_KEY_ID", "default"),
+		SinkExtraSecrets: envList("SINK_EXTRA_SECRETS"),
+		SinkMaxRows:      envInt("SINK_MAX_ROWS", 0),
+		SinkMaxBytes:     envInt("SINK_MAX_BYTES", 0),
+
 		Port:        envOr("PORT", "8080"),
 		HTTPTimeout: to,
 		LogLevel:    lvl,
+
+		AnomalyMethod:      envOr("ANOMALY_METHOD", "mad"),
+		AnomalyWindow:      envInt("ANOMALY_WINDOW", 7),
+		AnomalySensitivity: envFloat("ANOMALY_SENSITIVITY", 3),
+
+		BudgetPacingThreshold: envFloat("BUDGET_PACING_THRESHOLD", 0.1),
+
+		AlertWebhookURL:    os.Getenv("ALERT_WEBHOOK_URL"),
+		AlertWebhookSecret: envOr("ALERT_WEBHOOK_SECRET", os.Getenv("SINK_SECRET")),
+		AlertWebhookKeyID:  envOr("ALERT_WEBHOOK_KEY_ID", envOr("SINK_KEY_ID", "default")),
+		AlertDedupeWindow:  time.Duration(envInt("ALERT_DEDUPE_MINUTES", 60)) * time.Minute,
+		AlertCooldown:      time.Duration(envInt("ALERT_COOLDOWN_MINUTES", 30)) * time.Minute,
+		AlertQueueSize:     envInt("ALERT_QUEUE_SIZE", 100),
+		AlertTimeout:       time.Duration(envInt("ALERT_WEBHOOK_TIMEOUT_SECONDS", 10)) * time.Second,
+
+		ExportSinks: envList("EXPORT_SINKS"),
+		ExportDir:   os.Getenv("EXPORT_DIR"),
+		S3Endpoint:  os.Getenv("S3_ENDPOINT"),
+		S3Bucket:    os.Getenv("S3_BUCKET"),
+		S3Prefix:    os.Getenv("S3_PREFIX"),
+		S3Region:    envOr("S3_REGION", "us-east-1"),
+		S3AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey: os.Getenv("S3_SECRET_KEY"),
+
+		ExportRetryBase:        time.Duration(envInt("EXPORT_RETRY_BASE_SECONDS", 30)) * time.Second,
+		ExportRetryMax:         time.Duration(envInt("EXPORT_RETRY_MAX_SECONDS", 3600)) * time.Second,
+		ExportMaxAttempts:      envInt("EXPORT_MAX_ATTEMPTS", 8),
+		ExportDispatchInterval: time.Duration(envInt("EXPORT_DISPATCH_INTERVAL_SECONDS", 15)) * time.Second,
+		ExportOnChange:         os.Getenv("EXPORT_ON_CHANGE") != "false",
+		ExportJobHistory:       envInt("EXPORT_JOB_HISTORY", 200),
+		ExportLedgerHistory:    envInt("EXPORT_LEDGER_HISTORY", 1000),
+
+		TraceExporter:      os.Getenv("TRACE_EXPORTER"),
+		TraceFile:          envOr("TRACE_FILE", "traces.ndjson"),
+		OTLPEndpoint:       envOr("OTLP_ENDPOINT", "http://localhost:4318"),
+		TraceServiceName:   envOr("TRACE_SERVICE_NAME", "elt-go"),
+		TraceFlushInterval: time.Duration(envInt("TRACE_FLUSH_SECONDS", 5)) * time.Second,
+
+		AccessLogSample: envFloat("ACCESS_LOG_SAMPLE", 1),
+		TrustedProxies:  envList("TRUSTED_PROXIES"),
+
+		HealthIngestMaxAge: time.Duration(envInt("HEALTH_INGEST_MAX_AGE_MINUTES", 1440)) * time.Minute,
+		HealthCheckTimeout: time.Duration(envInt("HEALTH_CHECK_TIMEOUT_SECONDS", 2)) * time.Second,
+		HealthSinkProbe:    os.Getenv("HEALTH_SINK_PROBE") == "true",
+
+		ShutdownTimeout: time.Duration(envInt("SHUTDOWN_TIMEOUT_SECONDS", 25)) * time.Second,
+
+		Retry: retryFromEnv(),
+
+		BreakerFailures: envInt("BREAKER_FAILURES", 5),
+		BreakerCooldown: time.Duration(envInt("BREAKER_COOLDOWN_SECONDS", 30)) * time.Second,
+
+		IngestWorkers:       envInt("INGEST_WORKERS", 1),
+		IngestBatchSize:     envInt("INGEST_BATCH_SIZE", 500),
+		IngestPartialCommit: os.Getenv("INGEST_PARTIAL_COMMIT") == "true",
+	}
+}
+
+// Validate rechaza valores que de otro modo se ignorarían en silencio; main
+// sale al arrancar si falla.
+func (c Config) Validate() error {
+	var errs []error
+	switch c.AnomalyMethod {
+	case "mad", "zscore":
+	default:
+		errs = append(errs, fmt.Errorf("ANOMALY_METHOD %q: want mad or zscore", c.AnomalyMethod))
+	}
+	if c.AlertWebhookURL != "" && c.AlertWebhookSecret == "" {
+		errs = append(errs, errors.New("ALERT_WEBHOOK_URL set without ALERT_WEBHOOK_SECRET (or SINK_SECRET)"))
+	}
+	if _, err := signature.ParseKeys(c.SinkExtraSecrets); err != nil {
+		errs = append(errs, fmt.Errorf("SINK_EXTRA_SECRETS: %w", err))
+	}
+	if c.AccessLogSample < 0 || c.AccessLogSample > 1 {
+		errs = append(errs, fmt.Errorf("ACCESS_LOG_SAMPLE %v: want 0..1", c.AccessLogSample))
 	}
+	if c.ExportDispatchInterval <= 0 {
+		errs = append(errs, fmt.Errorf("EXPORT_DISPATCH_INTERVAL_SECONDS %s: must be > 0", c.ExportDispatchInterval))
+	}
+	return errors.Join(errs...)
+}
+
+// retryFromEnv lee RETRY_<DESTINO>_{MAX_ATTEMPTS,BASE_MS,MAX_MS}.
+func retryFromEnv() map[string]RetryConfig {
+	out := map[string]RetryConfig{}
+	for target, def := range defaultRetry {
+		p := "RETRY_" + strings.ToUpper(target) + "_"
+		out[target] = RetryConfig{
+			MaxAttempts: envInt(p+"MAX_ATTEMPTS", def.MaxAttempts),
+			BaseDelay:   time.Duration(envInt(p+"BASE_MS", int(def.BaseDelay/time.Millisecond))) * time.Millisecond,
+			MaxDelay:    time.Duration(envInt(p+"MAX_MS", int(def.MaxDelay/time.Millisecond))) * time.Millisecond,
+		}
+	}
+	return out
 }
 
 func envOr(k, def string) string {
@@ -45,3 +266,29 @@ func envOr(k, def string) string {
 	}
 	return v
 }
+
+func envInt(k string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(k))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func envFloat(k string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(k), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func envList(k string) []string {
+	var out []string
+	for _, p := range strings.Split(os.Getenv(k), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
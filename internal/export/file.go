@@ -0,0 +1,89 @@
+package export
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+)
+
+// FileSink escribe en disco particionado por día (Hive):
+// <dir>/date=YYYY-MM-DD/part-<Part>.<ext> o, con parquet,
+// <dir>/{metrics,daily_agg}/date=YYYY-MM-DD/part-<Part>.parquet, donde Part
+// es el filtro del lote ("all" sin filtro). Reexportar un día con el mismo
+// filtro reemplaza su archivo.
+type FileSink struct {
+	dir    string
+	format Format
+}
+
+func NewFileSink(dir string, f Format) *FileSink { return &FileSink{dir: dir, format: f} }
+
+func (s *FileSink) Name() string { return "file" }
+
+// Probe comprueba que el directorio se puede crear y escribir.
+func (s *FileSink) Probe(ctx context.Context) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.dir, "_probe")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func (s *FileSink) Write(ctx context.Context, b Batch) error {
+	for _, day := range splitDays(b) {
+		objs, err := objects(s.format, day)
+		if err != nil {
+			return err
+		}
+		for key, body := range objs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := s.put(filepath.Join(s.dir, filepath.FromSlash(key)), body); err != nil {
+				return err
+			}
+		}
+		// _VERSION junto a la partición (los loaders ignoran archivos con "_")
+		if v := day.Versions[day.From]; v > 0 {
+			for key := range objs {
+				dir := filepath.Join(s.dir, filepath.FromSlash(path.Dir(key)))
+				if err := s.put(filepath.Join(dir, "_VERSION"), []byte(strconv.Itoa(v)+"\n")); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// put escribe a temporal y renombra: un lector nunca ve un archivo a medias.
+func (s *FileSink) put(final string, body []byte) error {
+	dir := filepath.Dir(final)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), final); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
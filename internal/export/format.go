@@ -0,0 +1,115 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AngelCh415/ELT_GO/internal/models"
+)
+
+// Format es la codificación del archivo/payload: json (arreglo), ndjson o csv,
+// opcionalmente con gzip ("ndjson.gz"), o parquet (comprime por página).
+type Format struct {
+	Kind string // json | ndjson | csv
+	Gzip bool
+}
+
+func ParseFormat(s string) (Format, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	f := Format{Kind: strings.TrimSuffix(s, ".gz"), Gzip: strings.HasSuffix(s, ".gz")}
+	switch f.Kind {
+	case "json", "ndjson", "csv":
+		return f, nil
+	case "parquet":
+		if f.Gzip {
+			return f, errors.New("parquet already compresses its pages; use \"parquet\"")
+		}
+		return f, nil
+	}
+	return f, fmt.Errorf("unknown format %q (json|ndjson|csv[.gz]|parquet)", s)
+}
+
+func (f Format) Ext() string {
+	if f.Gzip {
+		return f.Kind + ".gz"
+	}
+	return f.Kind
+}
+
+func (f Format) ContentType() string {
+	switch f.Kind {
+	case "ndjson":
+		return "application/x-ndjson"
+	case "csv":
+		return "text/csv"
+	case "parquet":
+		return "application/vnd.apache.parquet"
+	}
+	return "application/json"
+}
+
+// Encode serializa las filas y comprime si corresponde.
+func (f Format) Encode(rows []models.Metrics) ([]byte, error) {
+	var buf bytes.Buffer
+	switch f.Kind {
+	case "json":
+		b, err := json.Marshal(rows)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	case "ndjson":
+		enc := json.NewEncoder(&buf)
+		for _, r := range rows {
+			if err := enc.Encode(r); err != nil {
+				return nil, err
+			}
+		}
+	case "csv":
+		if err := writeCSV(&buf, rows); err != nil {
+			return nil, err
+		}
+	case "parquet":
+		return MetricsParquet(rows)
+	}
+	if !f.Gzip {
+		return buf.Bytes(), nil
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return gz.Bytes(), nil
+}
+
+var csvHeader = []string{
+	"date", "channel", "campaign_id", "utm_campaign", "utm_source", "utm_medium",
+	"clicks", "impressions", "cost", "leads", "opportunities", "closed_won", "revenue",
+	"cpc", "cpa", "cvr_lead_to_opp", "cvr_opp_to_won", "roas",
+}
+
+func writeCSV(buf *bytes.Buffer, rows []models.Metrics) error {
+	w := csv.NewWriter(buf)
+	w.Write(csvHeader)
+	fl := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	for _, r := range rows {
+		w.Write([]string{
+			r.Date, r.Channel, r.CampaignID, r.UTMCampaign, r.UTMSource, r.UTMMedium,
+			strconv.Itoa(r.Clicks), strconv.Itoa(r.Impressions), fl(r.Cost), strconv.Itoa(r.Leads),
+			strconv.Itoa(r.Opportunities), strconv.Itoa(r.ClosedWon), fl(r.Revenue),
+			fl(r.CPC), fl(r.CPA), fl(r.CVRLeadToOpp), fl(r.CVROppToWon), fl(r.ROAS),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
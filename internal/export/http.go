@@ -0,0 +1,222 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/retry"
+	"github.com/AngelCh415/ELT_GO/pkg/signature"
+)
+
+// HTTPSink es el webhook original: POST del lote firmado (ver pkg/signature).
+type HTTPSink struct {
+	c        Doer
+	url      string
+	keys     []signature.Key
+	format   Format
+	maxRows  int // 0 = sin límite
+	maxBytes int
+	retry    retry.Policy
+}
+
+func NewHTTPSink(c Doer, url string, keys []signature.Key, f Format) *HTTPSink {
+	return &HTTPSink{c: c, url: url, keys: keys, format: f}
+}
+
+// Chunked fija los límites por request (filas y bytes del payload codificado).
+func (s *HTTPSink) Chunked(maxRows, maxBytes int) *HTTPSink {
+	s.maxRows, s.maxBytes = maxRows, maxBytes
+	return s
+}
+
+// WithRetry reintenta cada request dentro de Write (además del ledger).
+func (s *HTTPSink) WithRetry(p retry.Policy) *HTTPSink {
+	s.retry = p
+	return s
+}
+
+// SinkKeys devuelve las claves de firma: SINK_SECRET (id SINK_KEY_ID) primero
+// y luego las de SINK_EXTRA_SECRETS.
+func SinkKeys(cfg config.Config) ([]signature.Key, error) {
+	extra, err := signature.ParseKeys(cfg.SinkExtraSecrets)
+	if err != nil {
+		return nil, err
+	}
+	id := cfg.SinkKeyID
+	if id == "" {
+		id = "default"
+	}
+	return append([]signature.Key{{ID: id, Secret: cfg.SinkSecret}}, extra...), nil
+}
+
+func (s *HTTPSink) Name() string { return "http" }
+
+// Write hace POST del lote con un Idempotency-Key determinista (días y hash
+// del contenido): si un reintento llega después de que el receptor ya lo
+// procesó, éste lo puede descartar. Si el lote pasa de maxRows filas o
+// maxBytes bytes se parte en chunks ordenados y al final va un manifiesto.
+func (s *HTTPSink) Write(ctx context.Context, b Batch) error {
+	key := IdempotencyKey(b)
+	body, err := s.format.Encode(b.Rows)
+	if err != nil {
+		return err
+	}
+	if !s.over(len(b.Rows), len(body)) {
+		return s.post(ctx, body, s.format, key, b, nil)
+	}
+
+	chunks, err := s.chunk(b.Rows)
+	if err != nil {
+		return err
+	}
+	m := Manifest{
+		IdempotencyKey: key,
+		Seq:            b.Seq,
+		From:           b.From,
+		To:             b.To,
+		Rows:           len(b.Rows),
+		ContentHash:    contentHash(b.Rows),
+		Versions:       b.Versions,
+	}
+	for i, c := range chunks {
+		ck := fmt.Sprintf("%s-c%d", key, i+1)
+		hdr := map[string]string{"X-Export-Chunk": fmt.Sprintf("%d/%d", i+1, len(chunks))}
+		if err := s.post(ctx, c, s.format, ck, b, hdr); err != nil {
+			return fmt.Errorf("chunk %d/%d: %w", i+1, len(chunks), err)
+		}
+		m.Chunks = append(m.Chunks, ck)
+	}
+	mb, _ := json.Marshal(m)
+	return s.post(ctx, mb, Format{Kind: "json"}, key+"-manifest", b, map[string]string{"X-Export-Manifest": "true"})
+}
+
+// Manifest cierra un lote enviado en chunks: el receptor sólo debe dar el
+// lote por completo cuando recibió todos los Chunks.
+type Manifest struct {
+	IdempotencyKey string         `json:"idempotency_key"`
+	Seq            int            `json:"seq"`
+	From           string         `json:"from"`
+	To             string         `json:"to"`
+	Rows           int            `json:"rows"`
+	ContentHash    string         `json:"content_hash"`
+	Chunks         []string       `json:"chunks"` // Idempotency-Key de cada chunk, en orden
+	Versions       map[string]int `json:"versions,omitempty"`
+}
+
+// IdempotencyKey: "<from>[_<to>]-<hash>" con los primeros 16 hex del sha256
+// de las filas en JSON (igual para cualquier formato). No depende del job ni
+// del lote: el mismo contenido de los mismos días da la misma clave.
+func IdempotencyKey(b Batch) string {
+	days := b.From
+	if b.To != b.From {
+		days += "_" + b.To
+	}
+	return days + "-" + contentHash(b.Rows)[:16]
+}
+
+func contentHash(rows []models.Metrics) string {
+	j, _ := json.Marshal(rows)
+	h := sha256.Sum256(j)
+	return hex.EncodeToString(h[:])
+}
+
+func (s *HTTPSink) over(rows, size int) bool {
+	return (s.maxRows > 0 && rows > s.maxRows) || (s.maxBytes > 0 && size > s.maxBytes)
+}
+
+// chunk parte por filas y, si un trozo sigue pasando de maxBytes, lo divide
+// a la mitad hasta que entre (o quede de una fila).
+func (s *HTTPSink) chunk(rows []models.Metrics) ([][]byte, error) {
+	var out [][]byte
+	var split func(part []models.Metrics) error
+	split = func(part []models.Metrics) error {
+		body, err := s.format.Encode(part)
+		if err != nil {
+			return err
+		}
+		if len(part) > 1 && s.over(len(part), len(body)) {
+			if err := split(part[:len(part)/2]); err != nil {
+				return err
+			}
+			return split(part[len(part)/2:])
+		}
+		out = append(out, body)
+		return nil
+	}
+	step := len(rows)
+	if s.maxRows > 0 {
+		step = s.maxRows
+	}
+	for i := 0; i < len(rows); i += step {
+		j := i + step
+		if j > len(rows) {
+			j = len(rows)
+		}
+		if err := split(rows[i:j]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// post envía un request con la política de reintentos; cada intento se firma
+// de nuevo con la hora actual.
+func (s *HTTPSink) post(ctx context.Context, body []byte, f Format, key string, b Batch, hdr map[string]string) error {
+	return s.retry.Do(ctx, func(ctx context.Context, _ int) error {
+		return s.postOnce(ctx, body, f, key, b, hdr)
+	})
+}
+
+func (s *HTTPSink) postOnce(ctx context.Context, body []byte, f Format, key string, b Batch, hdr map[string]string) error {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	req.Header.Set("Content-Type", f.ContentType())
+	if f.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	// la firma cubre también la clave y las versiones: si no, un intermediario
+	// podría inflar las versiones y el receptor descartaría envíos válidos
+	req.Header.Set("Idempotency-Key", key)
+	signed := []string{"Idempotency-Key"}
+	if len(b.Versions) > 0 {
+		req.Header.Set("X-Export-Versions", VersionsHeader(b.Versions))
+		signed = append(signed, "X-Export-Versions")
+	}
+	for k, v := range hdr {
+		req.Header.Set(k, v)
+		signed = append(signed, k)
+	}
+	signature.SetHeaders(req.Header, s.keys, time.Now(), body, signed...)
+	resp, err := s.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &StatusError{Code: resp.StatusCode, Msg: "export sink non-2xx",
+			RetryAfter: retry.ParseRetryAfter(resp.Header.Get("Retry-After"), now())}
+	}
+	return nil
+}
+
+// Probe hace HEAD a la URL del sink: cualquier respuesta < 500 cuenta como
+// alcanzable (el receptor puede no aceptar HEAD).
+func (s *HTTPSink) Probe(ctx context.Context) error {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodHead, s.url, nil)
+	resp, err := s.c.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return &StatusError{Code: resp.StatusCode, Msg: "export sink probe"}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package export
+
+import (
+	"bytes"
+	"math"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/AngelCh415/ELT_GO/internal/models"
+)
+
+// Parquet con parquet-go: un archivo por tabla, páginas GZIP y columnas
+// REQUIRED. El esquema sale de los tags: fechas como DATE (INT32), montos y
+// ratios como DECIMAL(18,s) sobre INT64 y contadores como INT64.
+
+type metricsRow struct {
+	Date          int32  `parquet:"date,date"`
+	Channel       string `parquet:"channel"`
+	CampaignID    string `parquet:"campaign_id"`
+	UTMCampaign   string `parquet:"utm_campaign"`
+	UTMSource     string `parquet:"utm_source"`
+	UTMMedium     string `parquet:"utm_medium"`
+	Clicks        int64  `parquet:"clicks"`
+	Impressions   int64  `parquet:"impressions"`
+	Cost          int64  `parquet:"cost,decimal(2:18)"`
+	Leads         int64  `parquet:"leads"`
+	Opportunities int64  `parquet:"opportunities"`
+	ClosedWon     int64  `parquet:"closed_won"`
+	Revenue       int64  `parquet:"revenue,decimal(2:18)"`
+	CPC           int64  `parquet:"cpc,decimal(4:18)"`
+	CPA           int64  `parquet:"cpa,decimal(2:18)"`
+	CVRLeadToOpp  int64  `parquet:"cvr_lead_to_opp,decimal(4:18)"`
+	CVROppToWon   int64  `parquet:"cvr_opp_to_won,decimal(4:18)"`
+	ROAS          int64  `parquet:"roas,decimal(4:18)"`
+}
+
+type dailyAggRow struct {
+	Date          int32  `parquet:"date,date"`
+	Channel       string `parquet:"channel"`
+	CampaignID    string `parquet:"campaign_id"`
+	UTMCampaign   string `parquet:"utm_campaign"`
+	UTMSource     string `parquet:"utm_source"`
+	UTMMedium     string `parquet:"utm_medium"`
+	Clicks        int64  `parquet:"clicks"`
+	Impressions   int64  `parquet:"impressions"`
+	Cost          int64  `parquet:"cost,decimal(4:18)"`
+	Leads         int64  `parquet:"leads"`
+	Opportunities int64  `parquet:"opportunities"`
+	ClosedWon     int64  `parquet:"closed_won"`
+	Revenue       int64  `parquet:"revenue,decimal(4:18)"`
+}
+
+// pqDate son los días desde epoch (DATE).
+func pqDate(t time.Time) int32 { return int32(t.UTC().Unix() / 86400) }
+
+// pqDec escala f a un DECIMAL con scale dígitos.
+func pqDec(f float64, scale int) int64 { return int64(math.Round(f * math.Pow10(scale))) }
+
+// MetricsParquet serializa filas de métricas con su esquema tipado.
+func MetricsParquet(rows []models.Metrics) ([]byte, error) {
+	out := make([]metricsRow, len(rows))
+	for i, r := range rows {
+		d, err := time.Parse("2006-01-02", r.Date)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = metricsRow{
+			Date:          pqDate(d),
+			Channel:       r.Channel,
+			CampaignID:    r.CampaignID,
+			UTMCampaign:   r.UTMCampaign,
+			UTMSource:     r.UTMSource,
+			UTMMedium:     r.UTMMedium,
+			Clicks:        int64(r.Clicks),
+			Impressions:   int64(r.Impressions),
+			Cost:          pqDec(r.Cost, 2),
+			Leads:         int64(r.Leads),
+			Opportunities: int64(r.Opportunities),
+			ClosedWon:     int64(r.ClosedWon),
+			Revenue:       pqDec(r.Revenue, 2),
+			CPC:           pqDec(r.CPC, 4),
+			CPA:           pqDec(r.CPA, 2),
+			CVRLeadToOpp:  pqDec(r.CVRLeadToOpp, 4),
+			CVROppToWon:   pqDec(r.CVROppToWon, 4),
+			ROAS:          pqDec(r.ROAS, 4),
+		}
+	}
+	return writeParquet(out)
+}
+
+// DailyAggParquet serializa los agregados crudos (sin métricas derivadas).
+func DailyAggParquet(aggs []models.DailyAgg) ([]byte, error) {
+	out := make([]dailyAggRow, len(aggs))
+	for i, a := range aggs {
+		out[i] = dailyAggRow{
+			Date:          pqDate(a.Key.Date),
+			Channel:       a.Key.Channel,
+			CampaignID:    a.Key.CampaignID,
+			UTMCampaign:   a.Key.UTMCampaign,
+			UTMSource:     a.Key.UTMSource,
+			UTMMedium:     a.Key.UTMMedium,
+			Clicks:        int64(a.Clicks),
+			Impressions:   int64(a.Impressions),
+			Cost:          pqDec(a.Cost, 4),
+			Leads:         int64(a.Leads),
+			Opportunities: int64(a.Opportunities),
+			ClosedWon:     int64(a.ClosedWon),
+			Revenue:       pqDec(a.Revenue, 4),
+		}
+	}
+	return writeParquet(out)
+}
+
+func writeParquet[T any](rows []T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, rows, parquet.Compression(&parquet.Gzip), parquet.CreatedBy("ELT_GO", "", "")); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
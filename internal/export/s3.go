@@ -0,0 +1,192 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/retry"
+)
+
+var now = time.Now
+
+type S3Config struct {
+	Endpoint  string // p. ej. https://s3.us-east-1.amazonaws.com o http://localhost:9000 (MinIO)
+	Bucket    string
+	Prefix    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Sink sube objetos con PUT path-style firmado con AWS SigV4; sirve para
+// S3, MinIO o cualquier store compatible. Las claves siguen el mismo layout
+// que FileSink bajo <prefix>/.
+type S3Sink struct {
+	c      Doer
+	cfg    S3Config
+	format Format
+	retry  retry.Policy
+}
+
+func NewS3Sink(c Doer, cfg S3Config, f Format) *S3Sink {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &S3Sink{c: c, cfg: cfg, format: f}
+}
+
+// WithRetry reintenta cada PUT dentro de Write (además del ledger).
+func (s *S3Sink) WithRetry(p retry.Policy) *S3Sink {
+	s.retry = p
+	return s
+}
+
+func (s *S3Sink) Name() string { return "s3" }
+
+func (s *S3Sink) Write(ctx context.Context, b Batch) error {
+	for _, day := range splitDays(b) {
+		objs, err := objects(s.format, day)
+		if err != nil {
+			return err
+		}
+		for key, body := range objs {
+			if p := strings.Trim(s.cfg.Prefix, "/"); p != "" {
+				key = p + "/" + key
+			}
+			if err := s.put(ctx, key, body, day.Versions[day.From]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// put sube un objeto; version > 0 va como metadata x-amz-meta-export-version.
+func (s *S3Sink) put(ctx context.Context, key string, body []byte, version int) error {
+	return s.retry.Do(ctx, func(ctx context.Context, _ int) error { return s.putOnce(ctx, key, body, version) })
+}
+
+func (s *S3Sink) putOnce(ctx context.Context, key string, body []byte, version int) error {
+	path := "/" + awsEscape(s.cfg.Bucket) + "/" + awsEscapePath(key)
+	u, err := url.Parse(strings.TrimRight(s.cfg.Endpoint, "/") + path)
+	if err != nil {
+		return err
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	req.Header.Set("Content-Type", s.format.ContentType())
+	if s.format.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if version > 0 {
+		req.Header.Set("x-amz-meta-export-version", strconv.Itoa(version))
+	}
+	s.sign(req, path, body)
+
+	resp, err := s.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &StatusError{Code: resp.StatusCode, Msg: "s3 put " + key + " " + strings.TrimSpace(string(msg)),
+			RetryAfter: retry.ParseRetryAfter(resp.Header.Get("Retry-After"), now())}
+	}
+	return nil
+}
+
+// Probe hace HEAD al bucket con la misma firma que put.
+func (s *S3Sink) Probe(ctx context.Context) error {
+	path := "/" + awsEscape(s.cfg.Bucket)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, strings.TrimRight(s.cfg.Endpoint, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	s.sign(req, path, nil)
+	resp, err := s.c.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &StatusError{Code: resp.StatusCode, Msg: "s3 head bucket " + s.cfg.Bucket}
+	}
+	return nil
+}
+
+// sign agrega los headers de AWS Signature V4 (host, x-amz-date, x-amz-content-sha256).
+func (s *S3Sink) sign(req *http.Request, path string, body []byte) {
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		"", // sin query
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	k := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), date)
+	k = hmacSHA256(k, s.cfg.Region)
+	k = hmacSHA256(k, "s3")
+	k = hmacSHA256(k, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(k, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signed, sig))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// awsEscape codifica todo salvo los caracteres no reservados (RFC 3986), como exige SigV4.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func awsEscapePath(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = awsEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
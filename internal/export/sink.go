@@ -0,0 +1,217 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+)
+
+// Batch es un lote de filas a entregar; Seq numera los lotes de un mismo job.
+// Aggs son los DailyAgg crudos del mismo rango (solo los usa parquet).
+// Versions es la versión de cada día (creciente): el receptor descarta las viejas.
+// Part identifica el filtro del export: cada día se escribe entero en
+// date=<día>/part-<Part>, así reexportarlo con el mismo filtro lo reemplaza y
+// con otro filtro no lo pisa. Los días nunca se parten entre lotes.
+type Batch struct {
+	Seq      int
+	From     string // YYYY-MM-DD
+	To       string
+	Part     string // vacío = "all"
+	Rows     []models.Metrics
+	Aggs     []models.DailyAgg
+	Versions map[string]int
+}
+
+// Sink es un destino de exportación.
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, b Batch) error
+}
+
+// Prober lo implementan los sinks que pueden comprobar que el destino
+// responde sin escribir un lote (lo usa /readyz).
+type Prober interface {
+	Probe(ctx context.Context) error
+}
+
+// Doer es el subconjunto de http.Client que usan los sinks (ingest.HTTPClient lo cumple).
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// FromConfig arma los sinks de EXPORT_SINKS ("kind[:format]" separados por coma,
+// p. ej. "http,file:ndjson.gz,s3:csv.gz"). Vacío = webhook SINK_URL si está configurado.
+func FromConfig(cfg config.Config, c Doer) ([]Sink, error) {
+	specs := cfg.ExportSinks
+	if len(specs) == 0 && cfg.SinkURL != "" && cfg.SinkSecret != "" {
+		specs = []string{"http"}
+	}
+	var out []Sink
+	for _, spec := range specs {
+		kind, fmtName, _ := strings.Cut(strings.TrimSpace(spec), ":")
+		if fmtName == "" {
+			fmtName = "json"
+		}
+		f, err := ParseFormat(fmtName)
+		if err != nil {
+			return nil, fmt.Errorf("sink %q: %w", spec, err)
+		}
+		switch kind {
+		case "http":
+			if cfg.SinkURL == "" || cfg.SinkSecret == "" {
+				return nil, errors.New("sink http requires SINK_URL and SINK_SECRET")
+			}
+			keys, err := SinkKeys(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("SINK_EXTRA_SECRETS: %w", err)
+			}
+			out = append(out, NewHTTPSink(c, cfg.SinkURL, keys, f).Chunked(cfg.SinkMaxRows, cfg.SinkMaxBytes).
+				WithRetry(cfg.RetryPolicy("sink")))
+		case "file":
+			if cfg.ExportDir == "" {
+				return nil, errors.New("sink file requires EXPORT_DIR")
+			}
+			out = append(out, NewFileSink(cfg.ExportDir, f))
+		case "s3":
+			if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+				return nil, errors.New("sink s3 requires S3_ENDPOINT and S3_BUCKET")
+			}
+			out = append(out, NewS3Sink(c, S3Config{
+				Endpoint:  cfg.S3Endpoint,
+				Bucket:    cfg.S3Bucket,
+				Prefix:    cfg.S3Prefix,
+				Region:    cfg.S3Region,
+				AccessKey: cfg.S3AccessKey,
+				SecretKey: cfg.S3SecretKey,
+			}, f).WithRetry(cfg.RetryPolicy("sink")))
+		default:
+			return nil, fmt.Errorf("unknown sink kind %q (http|file|s3)", kind)
+		}
+	}
+	return out, nil
+}
+
+// StatusError es un rechazo non-2xx del destino; Code queda en el ledger y
+// RetryAfter (header Retry-After) lo respeta la política de reintentos.
+type StatusError struct {
+	Code       int
+	Msg        string
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string             { return fmt.Sprintf("%s: %d", e.Msg, e.Code) }
+func (e *StatusError) HTTPStatus() int           { return e.Code }
+func (e *StatusError) RetryDelay() time.Duration { return e.RetryAfter }
+
+// StatusCode extrae el código HTTP de un error de sink (0 si no aplica).
+func StatusCode(err error) int {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	return 0
+}
+
+// Multi escribe el lote en todos los sinks; no corta en el primer error para
+// que un destino caído no bloquee a los demás.
+type Multi []Sink
+
+func (m Multi) Name() string {
+	names := make([]string, len(m))
+	for i, s := range m {
+		names[i] = s.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (m Multi) Write(ctx context.Context, b Batch) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Write(ctx, b); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// splitDays parte el lote en uno por fecha (para particiones date=YYYY-MM-DD).
+func splitDays(b Batch) []Batch {
+	var out []Batch
+	idx := map[string]int{}
+	at := func(d string) *Batch {
+		i, ok := idx[d]
+		if !ok {
+			i = len(out)
+			idx[d] = i
+			out = append(out, Batch{Seq: b.Seq, From: d, To: d, Part: b.Part, Versions: b.Versions})
+		}
+		return &out[i]
+	}
+	for _, r := range b.Rows {
+		day := at(r.Date)
+		day.Rows = append(day.Rows, r)
+	}
+	for _, a := range b.Aggs {
+		day := at(a.Key.Date.Format("2006-01-02"))
+		day.Aggs = append(day.Aggs, a)
+	}
+	return out
+}
+
+// VersionsHeader serializa las versiones como "YYYY-MM-DD=v,..." ordenado por día.
+func VersionsHeader(v map[string]int) string {
+	days := make([]string, 0, len(v))
+	for d := range v {
+		days = append(days, d)
+	}
+	sort.Strings(days)
+	for i, d := range days {
+		days[i] = d + "=" + strconv.Itoa(v[d])
+	}
+	return strings.Join(days, ",")
+}
+
+// objects devuelve los archivos de un día (clave relativa => contenido).
+// Con parquet hay una tabla por dataset: metrics/ y daily_agg/.
+func objects(f Format, day Batch) (map[string][]byte, error) {
+	name := partName(day.Part, f)
+	out := map[string][]byte{}
+	if f.Kind != "parquet" {
+		body, err := f.Encode(day.Rows)
+		if err != nil {
+			return nil, err
+		}
+		out["date="+day.From+"/"+name] = body
+		return out, nil
+	}
+	if len(day.Rows) > 0 {
+		body, err := MetricsParquet(day.Rows)
+		if err != nil {
+			return nil, err
+		}
+		out["metrics/date="+day.From+"/"+name] = body
+	}
+	if len(day.Aggs) > 0 {
+		body, err := DailyAggParquet(day.Aggs)
+		if err != nil {
+			return nil, err
+		}
+		out["daily_agg/date="+day.From+"/"+name] = body
+	}
+	return out, nil
+}
+
+func partName(part string, f Format) string {
+	if part == "" {
+		part = "all"
+	}
+	return "part-" + part + "." + f.Ext()
+}
@@ -0,0 +1,216 @@
+// Package health tiene los checks de readiness: cada uno devuelve un mensaje
+// o un error, y los críticos que fallan hacen fallar /readyz.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/breaker"
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/export"
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+)
+
+// CheckFunc devuelve un detalle legible o el motivo del fallo.
+type CheckFunc func(ctx context.Context) (string, error)
+
+type check struct {
+	name     string
+	critical bool
+	fn       CheckFunc
+}
+
+// Result es el estado de un check: "ok" | "fail" (los no críticos que fallan
+// quedan en "warn").
+type Result struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Critical   bool   `json:"critical"`
+	Message    string `json:"message,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+type Report struct {
+	Status string   `json:"status"` // "ok" | "fail"
+	Checks []Result `json:"checks"`
+}
+
+// Registry corre los checks registrados, en paralelo y con timeout cada uno.
+type Registry struct {
+	timeout time.Duration
+	mu      sync.Mutex
+	checks  []check
+}
+
+func NewRegistry(timeout time.Duration) *Registry {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Registry{timeout: timeout}
+}
+
+func (r *Registry) Register(name string, critical bool, fn CheckFunc) {
+	r.mu.Lock()
+	r.checks = append(r.checks, check{name, critical, fn})
+	r.mu.Unlock()
+}
+
+// Run corre todos los checks; el reporte falla si falla alguno crítico.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.Lock()
+	checks := append([]check(nil), r.checks...)
+	r.mu.Unlock()
+
+	out := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			out[i] = r.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	rep := Report{Status: "ok", Checks: out}
+	for _, res := range out {
+		if res.Status == "fail" {
+			rep.Status = "fail"
+		}
+	}
+	return rep
+}
+
+func (r *Registry) run(ctx context.Context, c check) Result {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	type res struct {
+		msg string
+		err error
+	}
+	ch := make(chan res, 1)
+	go func() {
+		msg, err := c.fn(ctx)
+		ch <- res{msg, err}
+	}()
+	var got res
+	select {
+	case got = <-ch:
+	case <-ctx.Done():
+		got.err = fmt.Errorf("timeout after %s", r.timeout)
+	}
+	out := Result{Name: c.name, Status: "ok", Critical: c.critical, Message: got.msg, DurationMS: time.Since(start).Milliseconds()}
+	if got.err != nil {
+		out.Status, out.Message = "warn", got.err.Error()
+		if c.critical {
+			out.Status = "fail"
+		}
+	}
+	return out
+}
+
+// ---- checks ----
+
+// Config valida las URLs de las fuentes y que haya algún sink.
+func Config(cfg config.Config, sinks []export.Sink) CheckFunc {
+	return func(context.Context) (string, error) {
+		var errs []string
+		for _, u := range []struct{ env, v string }{{"ADS_API_URL", cfg.AdsURL}, {"CRM_API_URL", cfg.CrmURL}} {
+			if u.v == "" {
+				errs = append(errs, u.env+" is empty")
+				continue
+			}
+			if p, err := url.Parse(u.v); err != nil || p.Scheme == "" || p.Host == "" {
+				errs = append(errs, u.env+" is not an absolute URL")
+			}
+		}
+		if len(sinks) == 0 {
+			errs = append(errs, "no export sink configured")
+		}
+		if len(errs) > 0 {
+			return "", errors.New(strings.Join(errs, "; "))
+		}
+		names := make([]string, len(sinks))
+		for i, s := range sinks {
+			names[i] = s.Name()
+		}
+		sort.Strings(names)
+		return "sinks: " + strings.Join(names, ","), nil
+	}
+}
+
+// Ingest avisa si la fuente todavía no se descargó o si la última descarga
+// exitosa tiene más de maxAge (0 = sin límite). Se registra como no crítico.
+func Ingest(etl *ingest.ETL, source string, maxAge time.Duration) CheckFunc {
+	return func(context.Context) (string, error) {
+		t, ok := etl.LastIngest(source)
+		if !ok {
+			return "", errors.New("never ingested")
+		}
+		age := time.Since(t).Truncate(time.Second)
+		if maxAge > 0 && age > maxAge {
+			return "", fmt.Errorf("last ingest %s ago (max %s)", age, maxAge)
+		}
+		return "last ingest " + age.String() + " ago", nil
+	}
+}
+
+// Store comprueba que el store responde (un lock trabado termina en timeout).
+func Store(st *store.MemoryStore) CheckFunc {
+	return func(context.Context) (string, error) {
+		aggs, opps, _ := st.Counts()
+		return fmt.Sprintf("%d daily aggs, %d opportunities", aggs, opps), nil
+	}
+}
+
+// Sinks prueba los sinks que implementan export.Prober.
+func Sinks(sinks []export.Sink) CheckFunc {
+	return func(ctx context.Context) (string, error) {
+		var probed, errs []string
+		for _, s := range sinks {
+			p, ok := s.(export.Prober)
+			if !ok {
+				continue
+			}
+			if err := p.Probe(ctx); err != nil {
+				errs = append(errs, s.Name()+": "+err.Error())
+				continue
+			}
+			probed = append(probed, s.Name())
+		}
+		if len(errs) > 0 {
+			return "", errors.New(strings.Join(errs, "; "))
+		}
+		if len(probed) == 0 {
+			return "no probeable sinks", nil
+		}
+		return "reachable: " + strings.Join(probed, ","), nil
+	}
+}
+
+// Breakers informa los circuitos que no están cerrados.
+func Breakers(c *breaker.Client) CheckFunc {
+	return func(context.Context) (string, error) {
+		var states, open []string
+		for _, b := range c.Breakers() {
+			st := b.State()
+			states = append(states, b.Name()+"="+st.String())
+			if st != breaker.Closed {
+				open = append(open, b.Name()+" "+st.String())
+			}
+		}
+		if len(open) > 0 {
+			return "", errors.New("circuit " + strings.Join(open, ", "))
+		}
+		return strings.Join(states, ","), nil
+	}
+}
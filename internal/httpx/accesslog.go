@@ -0,0 +1,148 @@
+package httpx
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/utils"
+)
+
+// AccessLog configura el log de acceso.
+type AccessLog struct {
+	// fracción de requests exitosos (< 400) que se loguean: 0 = ninguno,
+	// 1 o nil = todos. Los errores y los panics se loguean siempre.
+	Sample *float64
+	// proxies cuyo X-Forwarded-For se respeta para la IP del cliente
+	TrustedProxies []*net.IPNet
+}
+
+// ParseProxies acepta CIDRs o IPs sueltas.
+func ParseProxies(list []string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", s, err)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// AccessLogger loguea cada request con status, bytes, IP y user agent, y
+// convierte un panic del handler en 500.
+func AccessLogger(log *slog.Logger, cfg AccessLog) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			var panicVal any
+			defer func() {
+				if v := recover(); v != nil {
+					if v == http.ErrAbortHandler {
+						panic(v)
+					}
+					panicVal = v
+					if rec.code == 0 {
+						http.Error(rec, "internal error", http.StatusInternalServerError)
+					}
+				}
+				code := rec.status()
+				if panicVal != nil {
+					code = http.StatusInternalServerError
+				}
+				class := classify(code, panicVal != nil)
+				if class == "ok" && cfg.Sample != nil && *cfg.Sample < 1 && rand.Float64() >= *cfg.Sample {
+					return
+				}
+				attrs := []slog.Attr{
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("route", routePattern(r)),
+					slog.Int("status", code),
+					slog.Int("bytes", rec.bytes),
+					slog.Duration("latency", time.Since(start)),
+					slog.String("rid", utils.RID(r.Context())),
+					slog.String("client_ip", clientIP(r, cfg.TrustedProxies)),
+					slog.String("user_agent", r.UserAgent()),
+					slog.String("class", class),
+				}
+				level := slog.LevelInfo
+				switch class {
+				case "client_error":
+					level = slog.LevelWarn
+				case "server_error", "panic":
+					level = slog.LevelError
+				}
+				if panicVal != nil {
+					attrs = append(attrs, slog.String("panic", fmt.Sprint(panicVal)), slog.String("stack", string(debug.Stack())))
+				}
+				log.LogAttrs(r.Context(), level, "http", attrs...)
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+func classify(code int, panicked bool) string {
+	switch {
+	case panicked:
+		return "panic"
+	case code >= 500:
+		return "server_error"
+	case code >= 400:
+		return "client_error"
+	}
+	return "ok"
+}
+
+// clientIP es RemoteAddr, salvo que venga de un proxy de confianza: entonces
+// recorre X-Forwarded-For de derecha a izquierda hasta la primera IP que no
+// sea de confianza.
+func clientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !isTrusted(ip, trusted) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		h := strings.TrimSpace(hops[i])
+		if net.ParseIP(h) == nil {
+			continue
+		}
+		ip = h
+		if !isTrusted(h, trusted) {
+			break
+		}
+	}
+	return ip
+}
+
+func isTrusted(ip string, trusted []*net.IPNet) bool {
+	p := net.ParseIP(ip)
+	if p == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package httpx
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/AngelCh415/ELT_GO/internal/telemetry"
+)
+
+// statusRecorder guarda el código que escribió el handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	code  int
+	bytes int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+func (s *statusRecorder) status() int {
+	if s.code == 0 {
+		return http.StatusOK
+	}
+	return s.code
+}
+
+// trace abre el span server de cada request (hijo del traceparent entrante,
+// si lo hay); el nombre usa el patrón de ruta, que se conoce al terminar.
+func trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := telemetry.StartSpan(telemetry.Extract(r.Context(), r.Header), r.Method, telemetry.KindServer)
+		defer span.End()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		route := routePattern(r)
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(attribute.String("http.method", r.Method), attribute.String("http.route", route),
+			attribute.Int("http.status_code", rec.status()))
+		if rec.status() >= 500 {
+			telemetry.Error(span, errors.New(http.StatusText(rec.status())))
+		}
+	})
+}
+
+func routePattern(r *http.Request) string {
+	if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+		return rc.RoutePattern()
+	}
+	return "unmatched"
+}
+
+// instrument mide cada request por patrón de ruta de chi (no por path, para
+// no explotar la cardinalidad con ids).
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		route := routePattern(r)
+		code := strconv.Itoa(rec.status())
+		telemetry.HTTPRequests.WithLabelValues(route, r.Method, code).Inc()
+		telemetry.HTTPLatency.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
@@ -2,26 +2,62 @@ package httpx
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/AngelCh415/ELT_GO/internal/alerts"
+	"github.com/AngelCh415/ELT_GO/internal/budget"
+	"github.com/AngelCh415/ELT_GO/internal/health"
 	"github.com/AngelCh415/ELT_GO/internal/ingest"
 	"github.com/AngelCh415/ELT_GO/internal/metrics"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/telemetry"
 	"github.com/AngelCh415/ELT_GO/internal/utils"
 )
 
 type router struct{ mux *chi.Mux }
 
-func NewRouter(log *slog.Logger, etl *ingest.ETL, mSvc *metrics.Service) http.Handler {
+// Deps agrupa los servicios que expone el router.
+type Deps struct {
+	Log     *slog.Logger
+	ETL     *ingest.ETL
+	Metrics *metrics.Service
+	Budgets *budget.Service
+	Alerts  *alerts.Service
+	Access  AccessLog
+	Health  *health.Registry
+}
+
+func NewRouter(d Deps) http.Handler {
+	log, etl, mSvc, bSvc, aSvc := d.Log, d.ETL, d.Metrics, d.Budgets, d.Alerts
 	mux := chi.NewRouter()
+	mux.Use(trace)
 	mux.Use(utils.RequestID)
-	mux.Use(utils.Logger(log))
+	mux.Use(instrument)
+	mux.Use(AccessLogger(log, d.Access))
 
+	// /healthz es liveness (el proceso responde); /readyz corre los checks y
+	// da 503 si falla alguno crítico
+	hSvc := d.Health
+	if hSvc == nil {
+		hSvc = health.NewRegistry(0)
+	}
 	mux.Get("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200); w.Write([]byte("ok")) })
-	mux.Get("/readyz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(200); w.Write([]byte("ready")) })
+	mux.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		rep := hSvc.Run(r.Context())
+		code := 200
+		if rep.Status != "ok" {
+			code = 503
+		}
+		writeJSONStatus(w, code, rep)
+	})
+	// métricas Prometheus del proceso (no confundir con /metrics/*, que son de negocio)
+	mux.Method("GET", "/metrics", telemetry.Handler())
 
 	mux.Post("/ingest/run", func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query().Get("since")
@@ -31,31 +67,119 @@ func NewRouter(log *slog.Logger, etl *ingest.ETL, mSvc *metrics.Service) http.Ha
 				since = &t
 			}
 		}
-		if err := etl.Run(r.Context(), since); err != nil {
-			http.Error(w, err.Error(), 502)
-			return
+		// partial=true|false pisa INGEST_PARTIAL_COMMIT para esta corrida
+		partial := etl.PartialCommit()
+		if v := r.URL.Query().Get("partial"); v != "" {
+			partial = v == "true"
+		}
+		rep, err := etl.Ingest(r.Context(), since, partial)
+		switch {
+		case err == nil:
+			writeJSONStatus(w, 202, rep)
+		case rep.Status == "partial":
+			writeJSONStatus(w, 207, map[string]any{"error": err.Error(), "report": rep})
+		default:
+			writeJSONStatus(w, errStatus(err, 502), map[string]any{"error": err.Error(), "report": rep})
 		}
-		w.WriteHeader(202)
-		w.Write([]byte("ingest started"))
 	})
 
+	// /export/run acepta date (un día) o from/to, filtros channel/utm_*,
+	// batch_rows y force=true (reenvía lo ya entregado sin cambios); con
+	// resume=<job id> reanuda un job fallido.
 	mux.Post("/export/run", func(w http.ResponseWriter, r *http.Request) {
-		q := r.URL.Query().Get("date")
-		if q == "" {
-			http.Error(w, "date required (YYYY-MM-DD)", 400)
+		q := r.URL.Query()
+		var job *models.ExportJob
+		var err error
+		// date= sin from/to mantiene la respuesta original {"exported": n}
+		legacy := q.Get("date") != "" && q.Get("resume") == ""
+		if id := q.Get("resume"); id != "" {
+			job, err = etl.ResumeExport(r.Context(), id)
+		} else {
+			fromQ, toQ := q.Get("from"), q.Get("to")
+			if d := q.Get("date"); d != "" {
+				fromQ, toQ = d, d
+			}
+			if fromQ == "" || toQ == "" {
+				http.Error(w, "date or from/to required (YYYY-MM-DD)", 400)
+				return
+			}
+			from, err1 := time.Parse("2006-01-02", fromQ)
+			to, err2 := time.Parse("2006-01-02", toQ)
+			if err1 != nil || err2 != nil {
+				http.Error(w, "bad date", 400)
+				return
+			}
+			batchRows := 0
+			if v := q.Get("batch_rows"); v != "" {
+				if batchRows, err = strconv.Atoi(v); err != nil || batchRows < 0 {
+					http.Error(w, "bad batch_rows", 400)
+					return
+				}
+			}
+			f := models.ExportFilter{
+				Channel:     q.Get("channel"),
+				UTMCampaign: q.Get("utm_campaign"),
+				UTMSource:   q.Get("utm_source"),
+				UTMMedium:   q.Get("utm_medium"),
+			}
+			force := q.Get("force") == "true"
+			job, err = etl.ExportRange(r.Context(), from, to, f, batchRows, force)
+		}
+		if job == nil {
+			http.Error(w, err.Error(), errStatus(err, 502))
 			return
 		}
-		t, err := time.Parse("2006-01-02", q)
 		if err != nil {
-			http.Error(w, "bad date", 400)
+			// el job queda reanudable: devolvemos su estado con el error
+			writeJSONStatus(w, errStatus(err, 502), map[string]any{"error": err.Error(), "job": job})
 			return
 		}
-		n, err := etl.ExportDay(r.Context(), t)
+		if legacy {
+			writeJSON(w, map[string]any{"exported": job.Exported, "job": job.ID})
+			return
+		}
+		writeJSON(w, job)
+	})
+
+	mux.Get("/export/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, err := etl.ExportJob(chi.URLParam(r, "id"))
 		if err != nil {
-			http.Error(w, err.Error(), 502)
+			http.Error(w, err.Error(), 404)
 			return
 		}
-		writeJSON(w, map[string]any{"exported": n})
+		writeJSON(w, job)
+	})
+
+	// /export/history: ledger de entregas; filtros day, from/to, sink, status
+	mux.Get("/export/history", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit, offset := 100, 0
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "bad limit", 400)
+				return
+			}
+			limit = n
+		}
+		if v := q.Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "bad offset", 400)
+				return
+			}
+			offset = n
+		}
+		rows := etl.ExportHistory(q)
+		total := len(rows)
+		if offset > total {
+			offset = total
+		}
+		end := offset + limit
+		if end > total {
+			end = total
+		}
+		writeJSON(w, map[string]any{"total": total, "limit": limit, "offset": offset, "entries": rows[offset:end]})
 	})
 
 	mux.Get("/metrics/channel", func(w http.ResponseWriter, r *http.Request) {
@@ -76,11 +200,191 @@ func NewRouter(log *slog.Logger, etl *ingest.ETL, mSvc *metrics.Service) http.Ha
 		writeJSON(w, rows)
 	})
 
+	mux.Get("/metrics/anomalies", func(w http.ResponseWriter, r *http.Request) {
+		rows, err := mSvc.QueryAnomalies(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		writeJSON(w, rows)
+	})
+
+	mux.Get("/metrics/forecast", func(w http.ResponseWriter, r *http.Request) {
+		rows, err := mSvc.Forecast(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		writeJSON(w, rows)
+	})
+
+	mux.Get("/metrics/cohorts", func(w http.ResponseWriter, r *http.Request) {
+		rows, err := mSvc.Cohorts(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		writeJSON(w, rows)
+	})
+
+	mux.Get("/metrics/velocity", func(w http.ResponseWriter, r *http.Request) {
+		rows, err := mSvc.Velocity(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		writeJSON(w, rows)
+	})
+
+	mux.Get("/budgets", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, bSvc.List())
+	})
+
+	mux.Post("/budgets", func(w http.ResponseWriter, r *http.Request) {
+		var in models.Budget
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "bad json", 400)
+			return
+		}
+		b, err := bSvc.Create(in)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		writeJSONStatus(w, 201, b)
+	})
+
+	// /budgets/pacing se registra antes que /budgets/{id}
+	mux.Get("/budgets/pacing", func(w http.ResponseWriter, r *http.Request) {
+		rows, err := bSvc.Pacing(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		writeJSON(w, rows)
+	})
+
+	mux.Get("/budgets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		b, err := bSvc.Get(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		writeJSON(w, b)
+	})
+
+	mux.Put("/budgets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var in models.Budget
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "bad json", 400)
+			return
+		}
+		b, err := bSvc.Update(chi.URLParam(r, "id"), in)
+		if errors.Is(err, budget.ErrNotFound) {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		writeJSON(w, b)
+	})
+
+	mux.Delete("/budgets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := bSvc.Delete(chi.URLParam(r, "id")); err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		w.WriteHeader(204)
+	})
+
+	mux.Get("/alerts", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, aSvc.Active())
+	})
+
+	mux.Post("/alerts/evaluate", func(w http.ResponseWriter, r *http.Request) {
+		aSvc.Evaluate(r.Context(), time.Now())
+		writeJSON(w, aSvc.Active())
+	})
+
+	mux.Get("/alerts/rules", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, aSvc.List())
+	})
+
+	mux.Post("/alerts/rules", func(w http.ResponseWriter, r *http.Request) {
+		var in models.AlertRule
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "bad json", 400)
+			return
+		}
+		rule, err := aSvc.Create(in)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		writeJSONStatus(w, 201, rule)
+	})
+
+	mux.Get("/alerts/rules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		rule, err := aSvc.Get(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		writeJSON(w, rule)
+	})
+
+	mux.Put("/alerts/rules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var in models.AlertRule
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "bad json", 400)
+			return
+		}
+		rule, err := aSvc.Update(chi.URLParam(r, "id"), in)
+		if errors.Is(err, alerts.ErrNotFound) {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		writeJSON(w, rule)
+	})
+
+	mux.Delete("/alerts/rules/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := aSvc.Delete(chi.URLParam(r, "id")); err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		w.WriteHeader(204)
+	})
+
 	return mux
 }
 
-func writeJSON(w http.ResponseWriter, v any) {
+// errStatus da 503 si el ETL se está apagando (el cliente puede reintentar
+// contra otra instancia) o def en otro caso.
+func errStatus(err error, def int) int {
+	switch {
+	case errors.Is(err, ingest.ErrShuttingDown):
+		return 503
+	case errors.Is(err, ingest.ErrBadRange):
+		return 400
+	case errors.Is(err, ingest.ErrJobNotFound):
+		return 404
+	case errors.Is(err, ingest.ErrJobRunning):
+		return 409
+	}
+	return def
+}
+
+func writeJSON(w http.ResponseWriter, v any) { writeJSONStatus(w, 200, v) }
+
+func writeJSONStatus(w http.ResponseWriter, code int, v any) {
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	enc := json.NewEncoder(w)
 	enc.SetIndent("", " ")
 	enc.Encode(v)
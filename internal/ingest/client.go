@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/telemetry"
 )
 
 type HTTPClient interface {
@@ -16,8 +18,9 @@ type HTTPClient interface {
 
 type client struct{ httpc *http.Client }
 
+// NewHTTPClient propaga traceparent y abre un span por request saliente.
 func NewHTTPClient(timeout time.Duration) HTTPClient {
-	return &http.Client{Timeout: timeout}
+	return &http.Client{Timeout: timeout, Transport: telemetry.Transport(nil)}
 }
 
 func getJSON(ctx context.Context, c HTTPClient, url string, v any) error {
@@ -2,34 +2,87 @@ package ingest
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"log/slog"
-	"net/http"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/export"
 	"github.com/AngelCh415/ELT_GO/internal/models"
 	"github.com/AngelCh415/ELT_GO/internal/store"
+	"github.com/AngelCh415/ELT_GO/internal/telemetry"
 )
 
 type ETL struct {
-	c   HTTPClient
-	st  *store.MemoryStore
-	log *slog.Logger
-	cfg config.Config
+	c     HTTPClient
+	st    *store.MemoryStore
+	log   *slog.Logger
+	cfg   config.Config
+	hooks []func(ctx context.Context)
+
+	sink   export.Multi
+	lastMu sync.Mutex
+	lastOK map[string]time.Time // última descarga exitosa por fuente
+	jobsMu sync.Mutex
+	jobSeq int
+	jobs   map[string]*models.ExportJob
+
+	// apagado ordenado (ver Shutdown)
+	drainMu   sync.Mutex
+	draining  bool
+	inflight  sync.WaitGroup
+	stop      context.Context
+	cancelAll context.CancelFunc
+}
+
+// NewETL recibe los sinks de exportación (ver export.FromConfig); sin sinks
+// usa el webhook SINK_URL/SINK_SECRET con JSON, como antes.
+func NewETL(c HTTPClient, st *store.MemoryStore, log *slog.Logger, cfg config.Config, sinks ...export.Sink) *ETL {
+	if len(sinks) == 0 && cfg.SinkURL != "" && cfg.SinkSecret != "" {
+		keys, err := export.SinkKeys(cfg)
+		if err != nil {
+			log.Error("export sink disabled: bad signing keys", slog.String("sink", cfg.SinkURL), slog.String("err", err.Error()))
+		} else {
+			sinks = []export.Sink{export.NewHTTPSink(c, cfg.SinkURL, keys, export.Format{Kind: "json"}).Chunked(cfg.SinkMaxRows, cfg.SinkMaxBytes).
+				WithRetry(cfg.RetryPolicy("sink"))}
+		}
+	}
+	stop, cancelAll := context.WithCancel(context.Background())
+	return &ETL{c: c, st: st, log: log, cfg: cfg, sink: sinks, lastOK: map[string]time.Time{}, jobs: map[string]*models.ExportJob{},
+		stop: stop, cancelAll: cancelAll}
+}
+
+// Sinks devuelve los destinos de exportación configurados.
+func (e *ETL) Sinks() []export.Sink { return e.sink }
+
+// LastIngest devuelve cuándo se guardó por última vez una descarga de la
+// fuente ("ads" | "crm").
+func (e *ETL) LastIngest(source string) (time.Time, bool) {
+	e.lastMu.Lock()
+	defer e.lastMu.Unlock()
+	t, ok := e.lastOK[source]
+	return t, ok
 }
 
-func NewETL(c HTTPClient, st *store.MemoryStore, log *slog.Logger, cfg config.Config) *ETL {
-	return &ETL{c: c, st: st, log: log, cfg: cfg}
+func (e *ETL) fetched(source string) {
+	e.lastMu.Lock()
+	e.lastOK[source] = time.Now().UTC()
+	e.lastMu.Unlock()
 }
 
-type adsResp []struct {
+// OnComplete registra funciones que corren al final de cada Run exitoso.
+func (e *ETL) OnComplete(fn func(ctx context.Context)) {
+	e.hooks = append(e.hooks, fn)
+}
+
+type adsResp []adsRow
+
+type adsRow struct {
 	Date        string  `json:"date"`
 	CampaignID  string  `json:"campaign_id"`
 	Channel     string  `json:"channel"`
@@ -41,43 +94,203 @@ type adsResp []struct {
 	UTMMedium   string  `json:"utm_medium"`
 }
 
-type crmResp []struct {
+type crmResp []crmRow
+
+type crmRow struct {
 	OpportunityID string  `json:"opportunity_id"`
 	ContactEmail  string  `json:"contact_email"`
 	Stage         string  `json:"stage"`
 	Amount        float64 `json:"amount"`
 	CreatedAt     string  `json:"created_at"`
+	UpdatedAt     string  `json:"updated_at"`
+	ClosedAt      string  `json:"closed_at"`
 	UTMCampaign   string  `json:"utm_campaign"`
 	UTMSource     string  `json:"utm_source"`
 	UTMMedium     string  `json:"utm_medium"`
+	// opcionales: si el CRM los expone evitan depender de transiciones observadas
+	StageChangedAt string `json:"stage_changed_at"`
+	StageHistory   []struct {
+		Stage     string `json:"stage"`
+		ChangedAt string `json:"changed_at"`
+	} `json:"stage_history"`
 }
 
+// Run ingesta ADS y CRM; con INGEST_PARTIAL_COMMIT=true guarda las fuentes
+// que anduvieron aunque otra falle (ver Ingest).
 func (e *ETL) Run(ctx context.Context, since *time.Time) error {
-	// ADS
-	var aResp adsResp
-	if err := GetJSONWithRetry(e.c, e.cfg.AdsURL, &aResp); err != nil {
-		return err
+	_, err := e.Ingest(ctx, since, e.cfg.IngestPartialCommit)
+	return err
+}
+
+// PartialCommit es el default de INGEST_PARTIAL_COMMIT.
+func (e *ETL) PartialCommit() bool { return e.cfg.IngestPartialCommit }
+
+// Ingest descarga las fuentes en paralelo y devuelve el resultado de cada
+// una. Sin partial, la primera falla cancela las demás descargas y no se
+// guarda nada; con partial se espera a ambas y, si sólo falló CRM, se guarda
+// ADS (status "partial"). CRM nunca se guarda sin ADS. err es el primer error
+// de descarga.
+func (e *ETL) Ingest(ctx context.Context, since *time.Time, partial bool) (rep models.IngestReport, err error) {
+	rep = models.IngestReport{Status: "failed", PartialCommit: partial, StartedAt: time.Now().UTC()}
+	ra, rc := &models.SourceResult{Source: "ads"}, &models.SourceResult{Source: "crm"}
+	defer func() {
+		rep.Sources = []models.SourceResult{*ra, *rc}
+		rep.DurationMS = time.Since(rep.StartedAt).Milliseconds()
+	}()
+	ctx, done, err := e.track(ctx)
+	if err != nil {
+		return rep, err
 	}
-	// CRM
+	defer done()
+	ctx, span := telemetry.StartSpan(ctx, "etl.run", telemetry.KindInternal)
+	defer span.End()
+
+	// ADS y CRM en paralelo; sin partial, si una falla se cancela la otra
+	var aResp adsResp
 	var cResp crmResp
-	if err := GetJSONWithRetry(e.c, e.cfg.CrmURL, &cResp); err != nil {
-		return err
+	var aErr, cErr error
+	g, gctx := newGroup(ctx)
+	if partial {
+		gctx = ctx
+	}
+	g.Go(func() error {
+		aErr = e.fetch(gctx, "ads", e.cfg.AdsURL, &aResp)
+		return aErr
+	})
+	g.Go(func() error {
+		cErr = e.fetch(gctx, "crm", e.cfg.CrmURL, &cResp)
+		return cErr
+	})
+	err = g.Wait()
+	for _, f := range []struct {
+		r   *models.SourceResult
+		n   int
+		err error
+	}{{ra, len(aResp), aErr}, {rc, len(cResp), cErr}} {
+		switch {
+		case f.err == nil:
+			f.r.Fetched = f.n
+		case errors.Is(f.err, context.Canceled) && ctx.Err() == nil:
+			f.r.Error = "canceled: another source failed"
+		default:
+			f.r.Error = f.err.Error()
+		}
+	}
+	if err != nil {
+		telemetry.Error(span, err)
+		// una corrida cancelada (apagado) no guarda nada, ni siquiera con
+		// partial. CRM sin ADS tampoco: los leads caerían en filas sin canal y,
+		// ya marcados como vistos, no se volverían a atribuir
+		if partial && aErr != nil && cErr == nil {
+			rc.Error = "skipped: ads failed"
+		}
+		if !partial || aErr != nil || ctx.Err() != nil {
+			return rep, err
+		}
+		// se guarda sólo ADS
+		cResp = nil
+		e.log.WarnContext(ctx, "ingest partial", slog.String("error", err.Error()))
 	}
 
-	// Normalizar + filtrar fechas
-	for _, r := range aResp {
-		d, err := time.Parse("2006-01-02", strings.TrimSpace(r.Date))
-		if err != nil {
+	ads, crm := e.normalize(ctx, aResp, cResp, since, ra, rc)
+	e.upsert(ctx, ads, crm, rc)
+	ra.Committed, rc.Committed = true, cErr == nil
+	e.fetched("ads")
+	if cErr == nil {
+		e.fetched("crm")
+	}
+	rep.Status = "ok"
+	if err != nil {
+		rep.Status = "partial"
+	}
+
+	e.log.InfoContext(ctx, "ingest complete", slog.String("status", rep.Status), slog.Int("agg_count", len(e.st.All())))
+	for _, h := range e.hooks {
+		h(ctx)
+	}
+	return rep, err
+}
+
+func (e *ETL) fetch(ctx context.Context, source, url string, dst any) error {
+	return GetJSONWithRetry(ctx, e.c, e.cfg.RetryPolicy(source), source, url, dst)
+}
+
+// parsed es una fila ya validada: result "" si se acepta, o "rejected" |
+// "filtered".
+type parsed[T any] struct {
+	key    string
+	v      T
+	result string
+}
+
+// normalize valida y limpia las filas y descarta las anteriores a since; los
+// duplicados de ads se descartan aquí, los de CRM en upsert (el lifecycle se
+// actualiza igual). El parseo se reparte entre INGEST_WORKERS; la
+// deduplicación va después y en orden, así gana la primera ocurrencia igual
+// que en secuencial.
+func (e *ETL) normalize(ctx context.Context, aResp adsResp, cResp crmResp, since *time.Time, ra, rc *models.SourceResult) ([]models.AdsPerformance, []store.CRMRecord) {
+	_, span := telemetry.StartSpan(ctx, "etl.normalize", telemetry.KindInternal)
+	defer span.End()
+
+	pa := make([]parsed[models.AdsPerformance], len(aResp))
+	parallel(e.cfg.IngestWorkers, len(aResp), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			pa[i] = parseAds(aResp[i], since)
+		}
+	})
+	pc := make([]parsed[models.Opportunity], len(cResp))
+	parallel(e.cfg.IngestWorkers, len(cResp), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			pc[i] = parseCRM(cResp[i], since)
+		}
+	})
+
+	// idempotencia de ads: un solo lock por lote
+	var ads []models.AdsPerformance
+	var keys []string
+	var ok []models.AdsPerformance
+	for _, p := range pa {
+		if p.result != "" {
+			count(ra, p.result)
 			continue
 		}
-		if since != nil && dayUTC(d).Before(dayUTC(*since)) {
+		keys = append(keys, p.key)
+		ok = append(ok, p.v)
+	}
+	seen := make([]bool, 0, len(keys))
+	batches(keys, e.cfg.IngestBatchSize, func(b []string) { seen = append(seen, e.st.MarkSeenBatch(b)...) })
+	for i, isNew := range seen {
+		if !isNew {
+			count(ra, "duplicate")
 			continue
 		}
-		key := "ads|" + r.Date + "|" + r.CampaignID + "|" + r.Channel
-		if !e.st.MarkSeen(key) {
+		count(ra, "accepted")
+		ads = append(ads, ok[i])
+	}
+
+	var crm []store.CRMRecord
+	for _, p := range pc {
+		if p.result != "" {
+			count(rc, p.result)
 			continue
-		} // idempotencia
-		e.st.UpsertAds(models.AdsPerformance{
+		}
+		crm = append(crm, store.CRMRecord{Key: p.key, Opp: p.v})
+	}
+	span.SetAttributes(attribute.Int("ads_rows", len(aResp)), attribute.Int("crm_rows", len(cResp)))
+	return ads, crm
+}
+
+func parseAds(r adsRow, since *time.Time) parsed[models.AdsPerformance] {
+	d, err := time.Parse("2006-01-02", strings.TrimSpace(r.Date))
+	if err != nil {
+		return parsed[models.AdsPerformance]{result: "rejected"}
+	}
+	if since != nil && dayUTC(d).Before(dayUTC(*since)) {
+		return parsed[models.AdsPerformance]{result: "filtered"}
+	}
+	return parsed[models.AdsPerformance]{
+		key: "ads|" + r.Date + "|" + r.CampaignID + "|" + r.Channel,
+		v: models.AdsPerformance{
 			Date:        d,
 			CampaignID:  strings.TrimSpace(r.CampaignID),
 			Channel:     strings.TrimSpace(r.Channel),
@@ -87,75 +300,122 @@ func (e *ETL) Run(ctx context.Context, since *time.Time) error {
 			UTMCampaign: coalesce(r.UTMCampaign, "unknown"),
 			UTMSource:   coalesce(r.UTMSource, "unknown"),
 			UTMMedium:   coalesce(r.UTMMedium, "unknown"),
-		})
+		},
 	}
+}
 
-	for _, r := range cResp {
-		if r.CreatedAt == "" {
-			continue
-		}
-		d, err := time.Parse(time.RFC3339, r.CreatedAt)
-		if err != nil {
-			continue
-		}
-		if since != nil && dayUTC(d).Before(dayUTC(*since)) {
-			continue
-		}
-		key := "crm|" + r.OpportunityID
-		if r.OpportunityID == "" {
-			key = "crm|" + d.Format(time.RFC3339) + "|" + r.ContactEmail
-		}
-		if !e.st.MarkSeen(key) {
-			continue
+func parseCRM(r crmRow, since *time.Time) parsed[models.Opportunity] {
+	if r.CreatedAt == "" {
+		return parsed[models.Opportunity]{result: "rejected"}
+	}
+	d, err := time.Parse(time.RFC3339, r.CreatedAt)
+	if err != nil {
+		return parsed[models.Opportunity]{result: "rejected"}
+	}
+	if since != nil && dayUTC(d).Before(dayUTC(*since)) {
+		return parsed[models.Opportunity]{result: "filtered"}
+	}
+	key := "crm|" + r.OpportunityID
+	if r.OpportunityID == "" {
+		key = "crm|" + d.Format(time.RFC3339) + "|" + r.ContactEmail
+	}
+	o := models.Opportunity{
+		OpportunityID:  r.OpportunityID,
+		ContactEmail:   strings.ToLower(strings.TrimSpace(r.ContactEmail)),
+		Stage:          strings.ToLower(strings.TrimSpace(r.Stage)),
+		Amount:         maxf(r.Amount),
+		CreatedAt:      d,
+		UpdatedAt:      parseTS(r.UpdatedAt),
+		ClosedAt:       parseTS(r.ClosedAt),
+		StageChangedAt: parseTS(r.StageChangedAt),
+		UTMCampaign:    coalesce(r.UTMCampaign, "unknown"),
+		UTMSource:      coalesce(r.UTMSource, "unknown"),
+		UTMMedium:      coalesce(r.UTMMedium, "unknown"),
+	}
+	if len(r.StageHistory) > 0 {
+		o.StageHistory = map[string]time.Time{}
+		for _, h := range r.StageHistory {
+			o.StageHistory[h.Stage] = parseTS(h.ChangedAt)
 		}
-		e.st.UpsertCRM(models.Opportunity{
-			OpportunityID: r.OpportunityID,
-			ContactEmail:  strings.ToLower(strings.TrimSpace(r.ContactEmail)),
-			Stage:         strings.ToLower(strings.TrimSpace(r.Stage)),
-			Amount:        maxf(r.Amount),
-			CreatedAt:     d,
-			UTMCampaign:   coalesce(r.UTMCampaign, "unknown"),
-			UTMSource:     coalesce(r.UTMSource, "unknown"),
-			UTMMedium:     coalesce(r.UTMMedium, "unknown"),
-		})
 	}
+	return parsed[models.Opportunity]{key: key, v: o}
+}
 
-	e.log.Info("ingest complete", slog.Int("agg_count", len(e.st.All())))
-	return nil
+// upsert escribe lo normalizado en el store por lotes de INGEST_BATCH_SIZE
+// (un lock por lote); ads va antes que CRM para que el cruce por UTM vea los
+// agregados del día.
+func (e *ETL) upsert(ctx context.Context, ads []models.AdsPerformance, crm []store.CRMRecord, rc *models.SourceResult) {
+	_, span := telemetry.StartSpan(ctx, "store.upsert", telemetry.KindInternal)
+	defer span.End()
 
+	batches(ads, e.cfg.IngestBatchSize, e.st.UpsertAdsBatch)
+	now := time.Now().UTC()
+	n := 0
+	batches(crm, e.cfg.IngestBatchSize, func(b []store.CRMRecord) {
+		// el lifecycle se actualiza siempre; el agregado diario solo la primera vez
+		for _, isNew := range e.st.IngestCRMBatch(b, now) {
+			if !isNew {
+				count(rc, "duplicate")
+				continue
+			}
+			count(rc, "accepted")
+			n++
+		}
+	})
+	span.SetAttributes(attribute.Int("ads_upserted", len(ads)), attribute.Int("crm_upserted", n))
 }
+
+// count suma una fila al resultado de la fuente y a ingest_records_total.
+func count(r *models.SourceResult, result string) {
+	telemetry.IngestRecords.WithLabelValues(r.Source, result).Inc()
+	switch result {
+	case "accepted":
+		r.Accepted++
+	case "duplicate":
+		r.Duplicates++
+	case "rejected":
+		r.Rejected++
+	case "filtered":
+		r.Filtered++
+	}
+}
+
+// ExportDay exporta un día completo; si ya se entregó sin cambios es un no-op (0).
 func (e *ETL) ExportDay(ctx context.Context, date time.Time) (int, error) {
-	if e.cfg.SinkURL == "" || e.cfg.SinkSecret == "" {
-		return 0, errors.New("sink not configured")
-	}
-	to := dayUTC(date)
-	from := to
-	rows := e.toMetrics(e.st.Query(from, to, nil))
-	if len(rows) == 0 {
-		return 0, nil
-	}
-	payload := rows // exportamos arreglo
-	b, _ := json.Marshal(payload)
-	mac := hmac.New(sha256.New, []byte(e.cfg.SinkSecret))
-	mac.Write(b)
-	sig := hex.EncodeToString(mac.Sum(nil))
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.SinkURL, strings.NewReader(string(b)))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Signature", sig)
-	resp, err := e.c.Do(req)
-	if err != nil {
+	ctx, span := telemetry.StartSpan(ctx, "export.day", telemetry.KindInternal)
+	defer span.End()
+	span.SetAttributes(attribute.String("day", date.Format("2006-01-02")))
+	job, err := e.ExportRange(ctx, date, date, models.ExportFilter{}, 0, false)
+	telemetry.Error(span, err)
+	if job == nil {
 		return 0, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return 0, errors.New("export sink non-2xx")
-	}
-	return len(rows), nil
+	span.SetAttributes(attribute.Int("rows", job.Exported))
+	return job.Exported, err
 }
 
 // Helpers de métricas calculadas
 func (e *ETL) toMetrics(aggs []models.DailyAgg) []models.Metrics {
-	sort.Slice(aggs, func(i, j int) bool { return aggs[i].Key.Date.Before(aggs[j].Key.Date) })
+	// orden total: mismo contenido => mismo payload (lotes y reanudación)
+	sort.Slice(aggs, func(i, j int) bool {
+		a, b := aggs[i].Key, aggs[j].Key
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+		if a.CampaignID != b.CampaignID {
+			return a.CampaignID < b.CampaignID
+		}
+		if a.UTMCampaign != b.UTMCampaign {
+			return a.UTMCampaign < b.UTMCampaign
+		}
+		if a.UTMSource != b.UTMSource {
+			return a.UTMSource < b.UTMSource
+		}
+		return a.UTMMedium < b.UTMMedium
+	})
 	out := make([]models.Metrics, 0, len(aggs))
 	for _, a := range aggs {
 		cpc := safeDivF(a.Cost, float64(max1(a.Clicks)))
@@ -194,6 +454,18 @@ func coalesce(s, def string) string {
 	}
 	return s
 }
+
+// parseTS acepta RFC3339 o YYYY-MM-DD; vacío o inválido = zero.
+func parseTS(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t
+	}
+	return time.Time{}
+}
 func dayUTC(t time.Time) time.Time {
 	y, m, d := t.UTC().Date()
 	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
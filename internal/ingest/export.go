@@ -0,0 +1,345 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/models"
+)
+
+var (
+	ErrJobNotFound = errors.New("export job not found")
+	ErrJobRunning  = errors.New("export job already running")
+	ErrBadRange    = errors.New("invalid export range")
+)
+
+// ExportRange exporta [from, to] filtrado, partido en lotes de un día o de a
+// lo sumo batchRows filas. Cada lote se entrega a cada sink vía el ledger: si
+// ya se entregó el mismo contenido se omite (salvo force). Si uno falla el
+// job queda "failed", el despachador lo reintenta en segundo plano y
+// ResumeExport continúa desde ese lote.
+func (e *ETL) ExportRange(ctx context.Context, from, to time.Time, f models.ExportFilter, batchRows int, force bool) (*models.ExportJob, error) {
+	return e.exportRange(ctx, from, to, f, batchRows, force, "")
+}
+
+func (e *ETL) exportRange(ctx context.Context, from, to time.Time, f models.ExportFilter, batchRows int, force bool, trigger string) (*models.ExportJob, error) {
+	ctx, done, err := e.track(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	if len(e.sink) == 0 {
+		return nil, errors.New("sink not configured")
+	}
+	from, to = dayUTC(from), dayUTC(to)
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: to before from", ErrBadRange)
+	}
+	if batchRows < 0 {
+		return nil, fmt.Errorf("%w: batch_rows must be >= 0", ErrBadRange)
+	}
+
+	// revisiones antes de leer: si algo cambia en medio, el día queda marcado
+	// con una revisión vieja y se vuelve a exportar
+	revs := e.st.DayRevisions(from, to)
+	// toMetrics ordena aggs en sitio: aggs[i] corresponde a rows[i]
+	aggs := e.st.Query(from, to, filterAgg(f))
+	rows := e.toMetrics(aggs)
+	now := time.Now().UTC()
+	e.jobsMu.Lock()
+	e.jobSeq++
+	job := &models.ExportJob{
+		ID:        "X-" + strconv.Itoa(e.jobSeq),
+		From:      from.Format("2006-01-02"),
+		To:        to.Format("2006-01-02"),
+		Filter:    f,
+		BatchRows: batchRows,
+		Force:     force,
+		Trigger:   trigger,
+		Status:    "running",
+		Batches:   planBatches(rows, aggs, batchRows, revs, partKey(f)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	e.jobs[job.ID] = job
+	e.pruneJobs()
+	e.jobsMu.Unlock()
+
+	return e.runJob(ctx, job)
+}
+
+// ResumeExport reintenta un job desde el primer lote no entregado.
+func (e *ETL) ResumeExport(ctx context.Context, id string) (*models.ExportJob, error) {
+	ctx, done, err := e.track(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	e.jobsMu.Lock()
+	job, ok := e.jobs[id]
+	if ok && job.Status == "running" {
+		e.jobsMu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrJobRunning, id)
+	}
+	if ok {
+		job.Status = "running"
+	}
+	e.jobsMu.Unlock()
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return e.runJob(ctx, job)
+}
+
+func (e *ETL) ExportJob(id string) (models.ExportJob, error) {
+	e.jobsMu.Lock()
+	defer e.jobsMu.Unlock()
+	job, ok := e.jobs[id]
+	if !ok {
+		return models.ExportJob{}, ErrJobNotFound
+	}
+	return copyJob(job), nil
+}
+
+// runJob envía en orden los lotes pendientes; se detiene en el primer error.
+func (e *ETL) runJob(ctx context.Context, job *models.ExportJob) (*models.ExportJob, error) {
+	var runErr error
+	for i := range job.Batches {
+		b := &job.Batches[i]
+		if b.Status == "done" || b.Status == "unchanged" {
+			continue
+		}
+		var err error
+		delivered := false
+		for _, sk := range e.sink {
+			if b.Sinks[sk.Name()] == "delivered" || b.Sinks[sk.Name()] == "unchanged" {
+				continue // ya entregado en un intento anterior de este job
+			}
+			st, serr := e.deliver(ctx, sk, *b, job.Force)
+			e.jobsMu.Lock()
+			b.Sinks[sk.Name()] = st
+			e.jobsMu.Unlock()
+			if serr != nil {
+				err = errors.Join(err, fmt.Errorf("%s: %w", sk.Name(), serr))
+			}
+			delivered = delivered || st == "delivered"
+		}
+
+		e.jobsMu.Lock()
+		b.Attempts++
+		job.UpdatedAt = time.Now().UTC()
+		switch {
+		case err != nil:
+			b.Status, b.Error = "failed", err.Error()
+		case delivered:
+			b.Status, b.Error = "done", ""
+			job.Exported += b.Rows
+		default:
+			b.Status, b.Error = "unchanged", ""
+			job.Skipped += b.Rows
+		}
+		e.jobsMu.Unlock()
+
+		e.log.Info("export batch",
+			slog.String("job", job.ID), slog.Int("seq", b.Seq), slog.Int("of", len(job.Batches)),
+			slog.String("from", b.From), slog.String("to", b.To), slog.Int("rows", b.Rows), slog.String("status", b.Status))
+		if err != nil {
+			runErr = fmt.Errorf("batch %d/%d (%s..%s): %w", b.Seq, len(job.Batches), b.From, b.To, err)
+			break
+		}
+	}
+
+	e.jobsMu.Lock()
+	job.Status = "done"
+	if runErr != nil {
+		job.Status = "failed"
+	}
+	out := copyJob(job)
+	if runErr == nil {
+		// sólo un job fallido necesita el snapshot para reanudarse
+		for i := range job.Batches {
+			job.Batches[i].Data, job.Batches[i].Aggs = nil, nil
+		}
+	}
+	e.jobsMu.Unlock()
+	e.markExported(&out)
+	return &out, runErr
+}
+
+// pruneJobs descarta los jobs terminados más viejos por encima de
+// EXPORT_JOB_HISTORY (0 = sin tope); se llama con jobsMu tomado.
+func (e *ETL) pruneJobs() {
+	max := e.cfg.ExportJobHistory
+	if max <= 0 || len(e.jobs) <= max {
+		return
+	}
+	ids := make([]string, 0, len(e.jobs))
+	for id, j := range e.jobs {
+		if j.Status != "running" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return jobNum(ids[i]) < jobNum(ids[j]) })
+	for _, id := range ids {
+		if len(e.jobs) <= max {
+			break
+		}
+		delete(e.jobs, id)
+	}
+}
+
+func jobNum(id string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(id, "X-"))
+	return n
+}
+
+// markExported registra la revisión de cada día entregado completo; sólo
+// cuentan los jobs sin filtro, que llevan el día entero.
+func (e *ETL) markExported(job *models.ExportJob) {
+	if job.Filter != (models.ExportFilter{}) {
+		return
+	}
+	pending := map[string]bool{}
+	for _, b := range job.Batches {
+		for d := range b.Versions {
+			pending[d] = pending[d] || (b.Status != "done" && b.Status != "unchanged")
+		}
+	}
+	for _, b := range job.Batches {
+		for d, v := range b.Versions {
+			if !pending[d] {
+				e.st.MarkExported(d, v)
+			}
+		}
+	}
+}
+
+// ExportChanged reexporta los días ya exportados cuyos agregados cambiaron
+// desde la última entrega (pensado como hook de OnComplete).
+func (e *ETL) ExportChanged(ctx context.Context) (int, error) {
+	if len(e.sink) == 0 {
+		return 0, nil
+	}
+	var n int
+	var errs []error
+	for _, d := range e.st.ChangedDays() {
+		day, _ := time.Parse("2006-01-02", d)
+		job, err := e.exportRange(ctx, day, day, models.ExportFilter{}, 0, false, "change")
+		if job != nil {
+			n += job.Exported
+			e.log.Info("export on change", slog.String("job", job.ID), slog.String("day", d),
+				slog.Int("rows", job.Exported), slog.String("status", job.Status))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", d, err))
+		}
+	}
+	return n, errors.Join(errs...)
+}
+
+// planBatches agrupa filas (ya ordenadas por fecha) en lotes de días
+// completos: uno por día, o con batchRows > 0 tantos días como entren en
+// batchRows filas (un día más grande va solo en su lote). aggs va alineado
+// con rows.
+func planBatches(rows []models.Metrics, aggs []models.DailyAgg, batchRows int, revs map[string]int, part string) []models.ExportBatch {
+	var out []models.ExportBatch
+	add := func(i, j int) {
+		versions := map[string]int{}
+		for _, r := range rows[i:j] {
+			versions[r.Date] = revs[r.Date]
+		}
+		out = append(out, models.ExportBatch{
+			Seq:      len(out) + 1,
+			From:     rows[i].Date,
+			To:       rows[j-1].Date,
+			Rows:     j - i,
+			Status:   "pending",
+			Sinks:    map[string]string{},
+			Versions: versions,
+			Part:     part,
+			Data:     rows[i:j],
+			Aggs:     aggs[i:j],
+		})
+	}
+	start := 0
+	for i := 0; i < len(rows); {
+		j := i + 1 // fin del día que empieza en i
+		for j < len(rows) && rows[j].Date == rows[i].Date {
+			j++
+		}
+		if i > start && (batchRows <= 0 || j-start > batchRows) {
+			add(start, i)
+			start = i
+		}
+		i = j
+	}
+	if start < len(rows) {
+		add(start, len(rows))
+	}
+	return out
+}
+
+// partKey nombra el filtro del export para los archivos de cada día: "all"
+// sin filtro o un hash corto de los filtros normalizados.
+func partKey(f models.ExportFilter) string {
+	if f == (models.ExportFilter{}) {
+		return "all"
+	}
+	chs := strings.Split(lower(f.Channel), ",")
+	for i := range chs {
+		chs[i] = strings.TrimSpace(chs[i])
+	}
+	sort.Strings(chs)
+	h := sha256.Sum256([]byte(strings.Join(chs, ",") + "|" + lower(f.UTMCampaign) + "|" + lower(f.UTMSource) + "|" + lower(f.UTMMedium)))
+	return hex.EncodeToString(h[:6])
+}
+
+func filterAgg(f models.ExportFilter) func(models.DailyAgg) bool {
+	chSet := map[string]struct{}{}
+	for _, c := range strings.Split(f.Channel, ",") {
+		if c = lower(c); c != "" {
+			chSet[c] = struct{}{}
+		}
+	}
+	utmC, utmS, utmM := lower(f.UTMCampaign), lower(f.UTMSource), lower(f.UTMMedium)
+	return func(a models.DailyAgg) bool {
+		if len(chSet) > 0 {
+			if _, ok := chSet[lower(a.Key.Channel)]; !ok {
+				return false
+			}
+		}
+		if utmC != "" && lower(a.Key.UTMCampaign) != utmC {
+			return false
+		}
+		if utmS != "" && lower(a.Key.UTMSource) != utmS {
+			return false
+		}
+		if utmM != "" && lower(a.Key.UTMMedium) != utmM {
+			return false
+		}
+		return true
+	}
+}
+
+func copyJob(j *models.ExportJob) models.ExportJob {
+	c := *j
+	c.Batches = append([]models.ExportBatch(nil), j.Batches...)
+	for i := range c.Batches {
+		sinks := make(map[string]string, len(c.Batches[i].Sinks))
+		for k, v := range c.Batches[i].Sinks {
+			sinks[k] = v
+		}
+		c.Batches[i].Sinks = sinks
+	}
+	return c
+}
+
+func lower(s string) string { return strings.ToLower(strings.TrimSpace(s)) }
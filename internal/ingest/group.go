@@ -0,0 +1,74 @@
+package ingest
+
+import (
+	"context"
+	"sync"
+)
+
+// group corre funciones en paralelo al estilo errgroup: el primer error
+// cancela el ctx de las demás y es el que devuelve Wait.
+type group struct {
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+	cancel context.CancelFunc
+}
+
+func newGroup(ctx context.Context) (*group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &group{cancel: cancel}, ctx
+}
+
+func (g *group) Go(fn func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := fn(); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				g.cancel()
+			})
+		}
+	}()
+}
+
+func (g *group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
+
+// parallel reparte [0, n) en hasta workers tramos contiguos y corre fn sobre
+// cada uno; con workers <= 1 corre en la goroutine actual.
+func parallel(workers, n int, fn func(lo, hi int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		fn(0, n)
+		return
+	}
+	size := (n + workers - 1) / workers
+	var wg sync.WaitGroup
+	for lo := 0; lo < n; lo += size {
+		hi := min(lo+size, n)
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			fn(lo, hi)
+		}(lo, hi)
+	}
+	wg.Wait()
+}
+
+// batches llama fn con tramos de hasta size elementos (size <= 0: uno solo).
+func batches[T any](rows []T, size int, fn func([]T)) {
+	if size <= 0 {
+		size = len(rows)
+	}
+	for len(rows) > 0 {
+		n := min(size, len(rows))
+		fn(rows[:n])
+		rows = rows[n:]
+	}
+}
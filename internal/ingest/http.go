@@ -1,32 +1,67 @@
 package ingest
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/AngelCh415/ELT_GO/internal/breaker"
+	"github.com/AngelCh415/ELT_GO/internal/retry"
+	"github.com/AngelCh415/ELT_GO/internal/telemetry"
 )
 
-func GetJSONWithRetry(c HTTPClient, url string, dst any) error {
-	var lastErr error
-	for i := 0; i < 3; i++ {
-		req, _ := http.NewRequest(http.MethodGet, url, nil)
-		resp, err := c.Do(req)
-		if err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			defer resp.Body.Close()
-			return json.NewDecoder(resp.Body).Decode(dst)
-		}
-		if err != nil {
-			lastErr = err
-		} else {
-			lastErr = errors.New(resp.Status)
-			resp.Body.Close()
+// GetJSONWithRetry hace GET reintentando según p (sólo errores de red, 408,
+// 425, 429 y 5xx; respeta Retry-After y ctx); source ("ads" | "crm") etiqueta
+// las métricas y el span de cada intento.
+func GetJSONWithRetry(ctx context.Context, c HTTPClient, p retry.Policy, source, url string, dst any) error {
+	err := p.Do(ctx, func(ctx context.Context, attempt int) error {
+		if attempt > 1 {
+			telemetry.IngestRetries.WithLabelValues(source).Inc()
 		}
-		// backoff exponencial + jitter
-		sleep := time.Duration((1<<i)*100) * time.Millisecond
-		sleep += time.Duration(rand.Intn(150)) * time.Millisecond
-		time.Sleep(sleep)
+		return getAttempt(ctx, c, source, url, attempt, dst)
+	})
+	if err != nil {
+		telemetry.IngestFailures.WithLabelValues(source).Inc()
+	}
+	return err
+}
+
+// getAttempt hace un intento; un JSON inválido no se reintenta.
+func getAttempt(ctx context.Context, c HTTPClient, source, url string, attempt int, dst any) (err error) {
+	ctx, span := telemetry.StartSpan(ctx, "ingest.fetch", telemetry.KindInternal)
+	span.SetAttributes(attribute.String("source", source), attribute.Int("attempt", attempt))
+	defer func() { telemetry.Error(span, err); span.End() }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return retry.Permanent(err)
+	}
+	start := time.Now()
+	resp, err := c.Do(req)
+	telemetry.IngestLatency.WithLabelValues(source).Observe(time.Since(start).Seconds())
+	var open *breaker.OpenError
+	code := "error"
+	switch {
+	case err == nil:
+		code = strconv.Itoa(resp.StatusCode)
+	case errors.As(err, &open):
+		code = "circuit_open"
+	}
+	telemetry.IngestRequests.WithLabelValues(source, code).Inc()
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := retry.FromResponse(resp); err != nil {
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		return retry.Permanent(err)
 	}
-	return lastErr
+	return nil
 }
@@ -0,0 +1,268 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/url"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/AngelCh415/ELT_GO/internal/breaker"
+	"github.com/AngelCh415/ELT_GO/internal/export"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/telemetry"
+)
+
+// deliver entrega un lote a un sink pasando por el ledger. Sólo manda los
+// días cuyo contenido cambió desde su última entrega a ese sink (con el mismo
+// part), sin importar en qué job o lote viajó; si no cambió ninguno y no es
+// forzado devuelve "unchanged". Si falla, la entrada queda en "retrying" para
+// el despachador.
+func (e *ETL) deliver(ctx context.Context, s export.Sink, b models.ExportBatch, force bool) (string, error) {
+	entry := models.LedgerEntry{
+		Seq: b.Seq, Sink: s.Name(), Part: b.Part,
+		DayHashes: dayHashes(b.Data, b.Aggs), Versions: b.Versions, Data: b.Data, Aggs: b.Aggs,
+		CreatedAt: time.Now().UTC(),
+	}
+	keep := map[string]bool{}
+	for d, h := range entry.DayHashes {
+		last, ok := e.st.LedgerLast(d, s.Name(), b.Part)
+		keep[d] = force || !ok || last.Status != "delivered" || last.DayHashes[d] != h
+	}
+	if !onlyDays(&entry, keep) {
+		telemetry.ExportAttempts.WithLabelValues(s.Name(), "unchanged").Inc()
+		return "unchanged", nil
+	}
+	// una entrada pendiente con alguno de estos días queda "superseded" al
+	// reclamarla: el índice ya apunta a ésta
+	entry.Status = "sending"
+	entry = e.st.LedgerPut(entry)
+
+	err := e.send(ctx, s, &entry)
+	return entry.Status, err
+}
+
+// onlyDays recorta la entrada a los días con keep[d] (con mapas nuevos: los
+// originales pueden ser del job o del store); devuelve false si no queda
+// ninguno.
+func onlyDays(entry *models.LedgerEntry, keep map[string]bool) bool {
+	var days []string
+	hashes, versions := map[string]string{}, map[string]int{}
+	for d, h := range entry.DayHashes {
+		if keep[d] {
+			days = append(days, d)
+			hashes[d] = h
+			if v, ok := entry.Versions[d]; ok {
+				versions[d] = v
+			}
+		}
+	}
+	if len(days) == 0 {
+		return false
+	}
+	entry.DayHashes, entry.Versions = hashes, versions
+	sort.Strings(days)
+	entry.Day, entry.To = days[0], days[len(days)-1]
+	if len(days) < len(keep) {
+		var rows []models.Metrics
+		var aggs []models.DailyAgg
+		for i, r := range entry.Data {
+			if keep[r.Date] {
+				rows = append(rows, r)
+				if i < len(entry.Aggs) {
+					aggs = append(aggs, entry.Aggs[i])
+				}
+			}
+		}
+		entry.Data, entry.Aggs = rows, aggs
+	}
+	entry.Rows = len(entry.Data)
+	h := sha256.New()
+	for _, d := range days {
+		h.Write([]byte(d + "=" + entry.DayHashes[d] + "\n"))
+	}
+	entry.Hash = hex.EncodeToString(h.Sum(nil))
+	return true
+}
+
+// send hace un intento sobre una entrada ya reclamada ("sending") y la guarda.
+func (e *ETL) send(ctx context.Context, s export.Sink, entry *models.LedgerEntry) error {
+	ctx, span := telemetry.StartSpan(ctx, "export.send", telemetry.KindInternal)
+	defer span.End()
+	span.SetAttributes(attribute.String("sink", s.Name()), attribute.String("day", entry.Day),
+		attribute.Int("seq", entry.Seq), attribute.Int("attempt", entry.Attempts+1))
+	start := time.Now()
+	err := s.Write(ctx, export.Batch{Seq: entry.Seq, From: entry.Day, To: entry.To, Part: entry.Part, Rows: entry.Data, Aggs: entry.Aggs, Versions: entry.Versions})
+	telemetry.ExportLatency.WithLabelValues(s.Name()).Observe(time.Since(start).Seconds())
+	now := time.Now().UTC()
+	entry.UpdatedAt = now
+	entry.ResponseCode = export.StatusCode(err)
+	// con el circuito abierto el envío ni salió: no cuenta como intento y se
+	// reprograma para cuando el breaker deje pasar
+	var open *breaker.OpenError
+	if errors.As(err, &open) {
+		telemetry.Error(span, err)
+		entry.Status, entry.Error = "retrying", err.Error()
+		entry.NextAttemptAt = open.Until.UTC()
+		telemetry.ExportAttempts.WithLabelValues(s.Name(), "breaker_open").Inc()
+		e.st.LedgerPut(*entry)
+		return err
+	}
+	entry.Attempts++
+	if err == nil {
+		entry.Status, entry.Error = "delivered", ""
+		entry.NextAttemptAt = time.Time{}
+		telemetry.ExportRows.WithLabelValues(s.Name()).Add(float64(entry.Rows))
+	} else {
+		telemetry.Error(span, err)
+		entry.Error = err.Error()
+		entry.Status = "retrying"
+		entry.NextAttemptAt = now.Add(e.retryDelay(entry.Attempts, err))
+		if max := e.cfg.ExportMaxAttempts; max > 0 && entry.Attempts >= max {
+			entry.Status = "dead"
+			entry.NextAttemptAt = time.Time{}
+		}
+	}
+	outcome := entry.Status
+	if outcome == "retrying" {
+		outcome = "failed"
+	}
+	telemetry.ExportAttempts.WithLabelValues(s.Name(), outcome).Inc()
+	e.st.LedgerPut(*entry)
+	if max := e.cfg.ExportLedgerHistory; max > 0 {
+		e.st.LedgerPrune(max)
+	}
+	return err
+}
+
+// retryDelay: backoff exponencial base·2^(n-1) con tope (0 = sin tope), o el
+// Retry-After del sink si pide esperar más.
+func (e *ETL) retryDelay(attempts int, err error) time.Duration {
+	d, max := e.cfg.ExportRetryBase, e.cfg.ExportRetryMax
+	for i := 1; i < attempts && (max <= 0 || d < max); i++ {
+		d *= 2
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	var ra interface{ RetryDelay() time.Duration }
+	if errors.As(err, &ra) && ra.RetryDelay() > d {
+		d = ra.RetryDelay()
+	}
+	return d
+}
+
+// RunDispatcher reintenta cada interval las entregas pendientes del ledger
+// hasta que ctx se cancele; con interval <= 0 no arranca.
+func (e *ETL) RunDispatcher(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		e.log.Warn("export dispatcher disabled", slog.Duration("interval", interval))
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			e.DispatchDue(ctx)
+		}
+	}
+}
+
+// DispatchDue hace un intento sobre cada entrada vencida; devuelve cuántas entregó.
+func (e *ETL) DispatchDue(ctx context.Context) int {
+	ctx, done, err := e.track(ctx)
+	if err != nil {
+		return 0
+	}
+	defer done()
+	sinks := map[string]export.Sink{}
+	for _, s := range e.sink {
+		sinks[s.Name()] = s
+	}
+	n := 0
+	for _, entry := range e.st.LedgerClaimDue(time.Now().UTC()) {
+		s, ok := sinks[entry.Sink]
+		if !ok {
+			entry.Status, entry.Error = "dead", "sink no longer configured"
+			e.st.LedgerPut(entry)
+			continue
+		}
+		// los días que ya llevó una entrada más nueva no se reenvían: pisarían
+		// una versión posterior; sin ninguno propio queda "superseded"
+		keep := map[string]bool{}
+		for d := range entry.DayHashes {
+			last, _ := e.st.LedgerLast(d, entry.Sink, entry.Part)
+			keep[d] = last.ID == entry.ID
+		}
+		if !onlyDays(&entry, keep) {
+			entry.Status, entry.UpdatedAt = "superseded", time.Now().UTC()
+			e.st.LedgerPut(entry)
+			continue
+		}
+		if err := e.send(ctx, s, &entry); err != nil {
+			e.log.Warn("export retry failed", slog.String("ledger", entry.ID), slog.String("sink", entry.Sink),
+				slog.Int("attempts", entry.Attempts), slog.String("status", entry.Status), slog.String("err", err.Error()))
+			continue
+		}
+		n++
+		e.log.Info("export retry delivered", slog.String("ledger", entry.ID), slog.String("sink", entry.Sink), slog.String("day", entry.Day))
+	}
+	return n
+}
+
+// ExportHistory lista el ledger; filtros: day, from, to (sobre day), sink, status.
+func (e *ETL) ExportHistory(v url.Values) []models.LedgerEntry {
+	day, from, to := v.Get("day"), v.Get("from"), v.Get("to")
+	sink, status := lower(v.Get("sink")), lower(v.Get("status"))
+	return e.st.Ledger(func(l models.LedgerEntry) bool {
+		switch {
+		case day != "" && l.Day != day:
+			return false
+		case from != "" && l.Day < from:
+			return false
+		case to != "" && l.Day > to:
+			return false
+		case sink != "" && l.Sink != sink:
+			return false
+		case status != "" && l.Status != status:
+			return false
+		}
+		return true
+	})
+}
+
+// dayHashes calcula el hash del contenido (filas y agregados) de cada día.
+func dayHashes(rows []models.Metrics, aggs []models.DailyAgg) map[string]string {
+	type day struct {
+		Rows []models.Metrics  `json:"rows"`
+		Aggs []models.DailyAgg `json:"aggs"`
+	}
+	byDay := map[string]*day{}
+	for i, r := range rows {
+		d := byDay[r.Date]
+		if d == nil {
+			d = &day{}
+			byDay[r.Date] = d
+		}
+		d.Rows = append(d.Rows, r)
+		if i < len(aggs) {
+			d.Aggs = append(d.Aggs, aggs[i])
+		}
+	}
+	out := make(map[string]string, len(byDay))
+	for k, d := range byDay {
+		b, _ := json.Marshal(d)
+		h := sha256.Sum256(b)
+		out[k] = hex.EncodeToString(h[:])
+	}
+	return out
+}
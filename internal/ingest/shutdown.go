@@ -0,0 +1,63 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrShuttingDown lo devuelven Run y los exports que llegan durante Shutdown.
+var ErrShuttingDown = errors.New("etl is shutting down")
+
+type trackedKey struct{}
+
+// track registra un job en curso. Durante Shutdown rechaza los nuevos, salvo
+// los anidados en uno ya registrado (p. ej. el export on change de un Run).
+// El ctx devuelto se cancela si Shutdown vence su plazo.
+func (e *ETL) track(ctx context.Context) (context.Context, func(), error) {
+	nested := ctx.Value(trackedKey{}) != nil
+	e.drainMu.Lock()
+	if e.draining && !nested {
+		e.drainMu.Unlock()
+		return ctx, nil, ErrShuttingDown
+	}
+	e.inflight.Add(1)
+	e.drainMu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, trackedKey{}, true))
+	stop := context.AfterFunc(e.stop, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+		e.inflight.Done()
+	}, nil
+}
+
+// Draining indica que Shutdown ya empezó.
+func (e *ETL) Draining() bool {
+	e.drainMu.Lock()
+	defer e.drainMu.Unlock()
+	return e.draining
+}
+
+// Shutdown deja de aceptar ingestas y exports y espera a los que están en
+// curso. Si ctx vence antes, los cancela: las descargas se abortan antes de
+// tocar el store y los lotes pendientes quedan en el ledger para reanudar.
+func (e *ETL) Shutdown(ctx context.Context) error {
+	e.drainMu.Lock()
+	e.draining = true
+	e.drainMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		e.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		e.cancelAll()
+		<-done
+		return ctx.Err()
+	}
+}
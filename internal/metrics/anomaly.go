@@ -0,0 +1,252 @@
+package metrics
+
+import (
+	"math"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/models"
+)
+
+// métricas vigiladas por el detector
+var anomalyMetrics = []string{"clicks", "cost", "leads", "cpa"}
+
+type seriesKey struct {
+	Channel    string
+	CampaignID string
+}
+
+// point es la suma de DailyAgg de un día para una serie (todas las UTMs).
+type point struct {
+	Date    time.Time
+	Clicks  int
+	Cost    float64
+	Leads   int
+	Revenue float64
+}
+
+func (p point) value(metric string) (float64, bool) {
+	switch metric {
+	case "clicks":
+		return float64(p.Clicks), true
+	case "cost":
+		return p.Cost, true
+	case "leads":
+		return float64(p.Leads), true
+	case "revenue":
+		return p.Revenue, true
+	case "cpa":
+		if p.Leads == 0 {
+			return 0, false
+		}
+		return p.Cost / float64(p.Leads), true
+	}
+	return 0, false
+}
+
+// buildSeries agrupa por clave y rellena con ceros los días sin filas,
+// para que una caída a cero también cuente como observación.
+func buildSeries(aggs []models.DailyAgg, key func(models.DailyAgg) seriesKey) map[seriesKey][]point {
+	byKey := map[seriesKey]map[time.Time]*point{}
+	for _, a := range aggs {
+		k := key(a)
+		days, ok := byKey[k]
+		if !ok {
+			days = map[time.Time]*point{}
+			byKey[k] = days
+		}
+		p, ok := days[a.Key.Date]
+		if !ok {
+			p = &point{Date: a.Key.Date}
+			days[a.Key.Date] = p
+		}
+		p.Clicks += a.Clicks
+		p.Cost += a.Cost
+		p.Leads += a.Leads
+		p.Revenue += a.Revenue
+	}
+
+	out := make(map[seriesKey][]point, len(byKey))
+	for k, days := range byKey {
+		var first, last time.Time
+		for d := range days {
+			if first.IsZero() || d.Before(first) {
+				first = d
+			}
+			if d.After(last) {
+				last = d
+			}
+		}
+		var pts []point
+		for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+			if p, ok := days[d]; ok {
+				pts = append(pts, *p)
+			} else {
+				pts = append(pts, point{Date: d})
+			}
+		}
+		out[k] = pts
+	}
+	return out
+}
+
+// DetectAnomalies recalcula las anomalías sobre todo el store y reemplaza
+// las guardadas. Devuelve cuántas encontró.
+func (s *Service) DetectAnomalies() int {
+	series := buildSeries(s.st.All(), func(a models.DailyAgg) seriesKey {
+		return seriesKey{Channel: a.Key.Channel, CampaignID: a.Key.CampaignID}
+	})
+
+	var found []models.Anomaly
+	for k, pts := range series {
+		for _, m := range anomalyMetrics {
+			found = append(found, s.scanSeries(k, m, pts)...)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Date != found[j].Date {
+			return found[i].Date < found[j].Date
+		}
+		if found[i].Channel != found[j].Channel {
+			return found[i].Channel < found[j].Channel
+		}
+		if found[i].CampaignID != found[j].CampaignID {
+			return found[i].CampaignID < found[j].CampaignID
+		}
+		return found[i].Metric < found[j].Metric
+	})
+
+	s.mu.Lock()
+	s.anomalies = found
+	s.mu.Unlock()
+	return len(found)
+}
+
+func (s *Service) scanSeries(k seriesKey, metric string, pts []point) []models.Anomaly {
+	window := s.cfg.AnomalyWindow
+	if window < 3 {
+		window = 3
+	}
+	sens := s.cfg.AnomalySensitivity
+	if sens <= 0 {
+		sens = 3
+	}
+
+	var out []models.Anomaly
+	var hist []float64 // últimos valores válidos (ventana móvil)
+	for _, p := range pts {
+		v, ok := p.value(metric)
+		if !ok {
+			continue
+		}
+		if len(hist) >= window {
+			center, spread := baseline(s.cfg.AnomalyMethod, hist)
+			// piso de dispersión: series casi constantes no deben marcar ruido mínimo
+			if floor := 0.05 * math.Abs(center); spread < floor {
+				spread = floor
+			}
+			if spread > 0 {
+				lower := math.Max(0, center-sens*spread)
+				upper := center + sens*spread
+				if v < lower || v > upper {
+					dir := "spike"
+					if v < lower {
+						dir = "drop"
+					}
+					out = append(out, models.Anomaly{
+						Date:       p.Date.Format("2006-01-02"),
+						Channel:    k.Channel,
+						CampaignID: k.CampaignID,
+						Metric:     metric,
+						Observed:   round2(v),
+						Expected:   round2(center),
+						Lower:      round2(lower),
+						Upper:      round2(upper),
+						Score:      round2((v - center) / spread),
+						Direction:  dir,
+					})
+				}
+			}
+		}
+		hist = append(hist, v)
+		if len(hist) > window {
+			hist = hist[1:]
+		}
+	}
+	return out
+}
+
+// baseline devuelve centro y dispersión de la ventana según el método.
+func baseline(method string, xs []float64) (float64, float64) {
+	if method == "zscore" {
+		var sum float64
+		for _, x := range xs {
+			sum += x
+		}
+		mean := sum / float64(len(xs))
+		var ss float64
+		for _, x := range xs {
+			ss += (x - mean) * (x - mean)
+		}
+		return mean, math.Sqrt(ss / float64(len(xs)))
+	}
+	med := median(xs)
+	dev := make([]float64, len(xs))
+	for i, x := range xs {
+		dev[i] = math.Abs(x - med)
+	}
+	// 1.4826 escala la MAD a desviación estándar bajo normalidad
+	return med, 1.4826 * median(dev)
+}
+
+func median(xs []float64) float64 {
+	c := append([]float64(nil), xs...)
+	sort.Float64s(c)
+	n := len(c)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return c[n/2]
+	}
+	return (c[n/2-1] + c[n/2]) / 2
+}
+
+func (s *Service) QueryAnomalies(v url.Values) ([]models.Anomaly, error) {
+	from := v.Get("from")
+	to := v.Get("to")
+	chSet := csvSet(v.Get("channel"))
+	campaign := norm(v.Get("campaign_id"))
+	metric := norm(v.Get("metric"))
+	limit := atoiDef(v.Get("limit"), 100)
+	offset := atoiDef(v.Get("offset"), 0)
+
+	s.mu.RLock()
+	var rows []models.Anomaly
+	for _, a := range s.anomalies {
+		// fechas YYYY-MM-DD comparan bien como string
+		if from != "" && a.Date < from {
+			continue
+		}
+		if to != "" && a.Date > to {
+			continue
+		}
+		if len(chSet) > 0 {
+			if _, ok := chSet[norm(a.Channel)]; !ok {
+				continue
+			}
+		}
+		if campaign != "" && norm(a.CampaignID) != campaign {
+			continue
+		}
+		if metric != "" && a.Metric != metric {
+			continue
+		}
+		rows = append(rows, a)
+	}
+	s.mu.RUnlock()
+
+	limit, offset = clampLimitOffset(limit, offset, len(rows))
+	return paginate(rows, limit, offset), nil
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/models"
+)
+
+// Cohorts arma la matriz de cohortes por semana (lunes) o mes de creación:
+// para cada edad N en buckets, cuántos leads cerraron ganados dentro de N
+// días y el revenue acumulado.
+func (s *Service) Cohorts(v url.Values) ([]models.Cohort, error) {
+	from, _ := time.Parse("2006-01-02", v.Get("from"))
+	to, _ := time.Parse("2006-01-02", v.Get("to"))
+	if to.IsZero() {
+		to = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	}
+	gran := norm(v.Get("granularity"))
+	if gran == "" {
+		gran = "week"
+	}
+	if gran != "week" && gran != "month" {
+		return nil, errors.New("granularity must be week or month")
+	}
+	buckets := []int{30, 60, 90}
+	if q := v.Get("buckets"); q != "" {
+		buckets = nil
+		for _, p := range strings.Split(q, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil || n <= 0 {
+				return nil, errors.New("buckets must be positive day counts (e.g. 30,60,90)")
+			}
+			buckets = append(buckets, n)
+		}
+		sort.Ints(buckets)
+	}
+	asOf := dayOf(time.Now())
+	if q := v.Get("as_of"); q != "" {
+		t, err := time.Parse("2006-01-02", q)
+		if err != nil {
+			return nil, errors.New("bad as_of (YYYY-MM-DD)")
+		}
+		asOf = t
+	}
+	utmC := norm(v.Get("utm_campaign"))
+	utmS := norm(v.Get("utm_source"))
+	utmM := norm(v.Get("utm_medium"))
+
+	opps := s.st.Opportunities(from, to, func(o models.OpportunityLifecycle) bool {
+		if utmC != "" && norm(o.UTMCampaign) != utmC {
+			return false
+		}
+		if utmS != "" && norm(o.UTMSource) != utmS {
+			return false
+		}
+		if utmM != "" && norm(o.UTMMedium) != utmM {
+			return false
+		}
+		return true
+	})
+
+	type acc struct {
+		start, end time.Time
+		leads      int
+		won        []int
+		rev        []float64
+	}
+	byCohort := map[time.Time]*acc{}
+	for _, o := range opps {
+		created := dayOf(o.CreatedAt)
+		start, end := cohortPeriod(created, gran)
+		c, ok := byCohort[start]
+		if !ok {
+			c = &acc{start: start, end: end, won: make([]int, len(buckets)), rev: make([]float64, len(buckets))}
+			byCohort[start] = c
+		}
+		c.leads++
+
+		// un won visto por primera vez ya ganado no tiene fecha real de cierre
+		wonAt, ok := stageTime(o, "closed_won")
+		if !ok || dayOf(wonAt).After(asOf) {
+			continue
+		}
+		age := int(dayOf(wonAt).Sub(created).Hours() / 24)
+		for i, n := range buckets {
+			if age <= n {
+				c.won[i]++
+				c.rev[i] += o.Amount
+			}
+		}
+	}
+
+	out := make([]models.Cohort, 0, len(byCohort))
+	for _, c := range byCohort {
+		row := models.Cohort{Cohort: c.start.Format("2006-01-02"), Leads: c.leads}
+		for i, n := range buckets {
+			row.Buckets = append(row.Buckets, models.CohortBucket{
+				Days:       n,
+				ClosedWon:  c.won[i],
+				Conversion: round3(float64(c.won[i]) / float64(c.leads)),
+				Revenue:    round2(c.rev[i]),
+				Complete:   !c.end.AddDate(0, 0, n).After(asOf),
+			})
+		}
+		out = append(out, row)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Cohort < out[j].Cohort })
+	return out, nil
+}
+
+// cohortPeriod devuelve inicio y fin (inclusive) de la semana ISO o del mes.
+func cohortPeriod(d time.Time, gran string) (time.Time, time.Time) {
+	if gran == "month" {
+		start := time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, -1)
+	}
+	offset := (int(d.Weekday()) + 6) % 7 // lunes = 0
+	start := d.AddDate(0, 0, -offset)
+	return start, start.AddDate(0, 0, 6)
+}
+
+func dayOf(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/models"
+)
+
+// HWModel es un Holt-Winters aditivo ya ajustado (nivel, tendencia, estacionalidad).
+// Con Period == 0 se comporta como Holt lineal (sin estacionalidad).
+type HWModel struct {
+	Alpha, Beta, Gamma float64
+	Period             int
+	level, trend       float64
+	season             []float64
+	n                  int     // puntos vistos
+	Sigma              float64 // desv. estándar de errores a un paso
+}
+
+// FitHoltWinters ajusta el modelo buscando alpha/beta/gamma en una rejilla
+// que minimiza el error cuadrático a un paso. Si no hay al menos dos
+// temporadas completas, cae a Holt lineal.
+func FitHoltWinters(y []float64, period int) (*HWModel, error) {
+	if len(y) < 3 {
+		return nil, errors.New("serie demasiado corta")
+	}
+	if period > 0 && len(y) < 2*period {
+		period = 0
+	}
+	grid := []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7, 0.9}
+	gammas := grid
+	if period == 0 {
+		gammas = []float64{0}
+	}
+	var best *HWModel
+	bestSSE := math.Inf(1)
+	for _, a := range grid {
+		for _, b := range grid {
+			for _, g := range gammas {
+				m := &HWModel{Alpha: a, Beta: b, Gamma: g, Period: period}
+				sse := m.fit(y)
+				if sse < bestSSE {
+					bestSSE, best = sse, m
+				}
+			}
+		}
+	}
+	return best, nil
+}
+
+// fit inicializa y recorre la serie; devuelve la suma de errores al cuadrado.
+func (m *HWModel) fit(y []float64) float64 {
+	p := m.Period
+	start := 1
+	if p > 0 {
+		// nivel = media de la primera temporada; tendencia = cambio medio entre las dos primeras
+		var s1, s2 float64
+		for i := 0; i < p; i++ {
+			s1 += y[i]
+			s2 += y[p+i]
+		}
+		m.level = s1 / float64(p)
+		m.trend = (s2 - s1) / float64(p*p)
+		m.season = make([]float64, p)
+		for i := 0; i < p; i++ {
+			m.season[i] = y[i] - m.level
+		}
+		start = p
+	} else {
+		m.level = y[0]
+		m.trend = y[1] - y[0]
+	}
+
+	var sse float64
+	var cnt int
+	for t := start; t < len(y); t++ {
+		var s float64
+		if p > 0 {
+			s = m.season[t%p]
+		}
+		pred := m.level + m.trend + s
+		e := y[t] - pred
+		sse += e * e
+		cnt++
+
+		prevLevel := m.level
+		m.level = m.Alpha*(y[t]-s) + (1-m.Alpha)*(m.level+m.trend)
+		m.trend = m.Beta*(m.level-prevLevel) + (1-m.Beta)*m.trend
+		if p > 0 {
+			m.season[t%p] = m.Gamma*(y[t]-m.level) + (1-m.Gamma)*s
+		}
+	}
+	m.n = len(y)
+	if cnt > 0 {
+		m.Sigma = math.Sqrt(sse / float64(cnt))
+	}
+	return sse
+}
+
+// Predict devuelve h pronósticos con intervalo ±z·σ·√k (crece con el horizonte).
+func (m *HWModel) Predict(h int, z float64) (point, lower, upper []float64) {
+	point = make([]float64, h)
+	lower = make([]float64, h)
+	upper = make([]float64, h)
+	for k := 1; k <= h; k++ {
+		v := m.level + float64(k)*m.trend
+		if m.Period > 0 {
+			v += m.season[(m.n+k-1)%m.Period]
+		}
+		w := z * m.Sigma * math.Sqrt(float64(k))
+		point[k-1], lower[k-1], upper[k-1] = v, v-w, v+w
+	}
+	return point, lower, upper
+}
+
+var forecastMetrics = []string{"cost", "leads", "revenue"}
+
+// z para niveles de confianza soportados
+var zByLevel = map[int]float64{80: 1.2816, 90: 1.6449, 95: 1.96, 99: 2.5758}
+
+func (s *Service) Forecast(v url.Values) ([]models.Forecast, error) {
+	from, _ := time.Parse("2006-01-02", v.Get("from"))
+	to, _ := time.Parse("2006-01-02", v.Get("to"))
+	group := norm(v.Get("group"))
+	if group == "" {
+		group = "channel"
+	}
+	if group != "channel" && group != "campaign" {
+		return nil, errors.New("group must be channel or campaign")
+	}
+	chSet := csvSet(v.Get("channel"))
+	campaign := norm(v.Get("campaign_id"))
+	days := atoiDef(v.Get("days"), 14)
+	if days <= 0 || days > 90 {
+		return nil, errors.New("days must be between 1 and 90")
+	}
+	z, ok := zByLevel[atoiDef(v.Get("level"), 95)]
+	if !ok {
+		return nil, errors.New("level must be one of 80, 90, 95, 99")
+	}
+	wanted := forecastMetrics
+	if m := v.Get("metric"); m != "" {
+		wanted = nil
+		for k := range csvSet(m) {
+			if k != "cost" && k != "leads" && k != "revenue" {
+				return nil, errors.New("metric must be cost, leads or revenue")
+			}
+			wanted = append(wanted, k)
+		}
+		sort.Strings(wanted)
+	}
+
+	if to.IsZero() {
+		to = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	}
+	aggs := s.st.Query(from, to, func(a models.DailyAgg) bool {
+		if len(chSet) > 0 {
+			if _, ok := chSet[norm(a.Key.Channel)]; !ok {
+				return false
+			}
+		}
+		if campaign != "" && norm(a.Key.CampaignID) != campaign {
+			return false
+		}
+		return true
+	})
+	series := buildSeries(aggs, func(a models.DailyAgg) seriesKey {
+		if group == "channel" {
+			return seriesKey{Channel: a.Key.Channel}
+		}
+		return seriesKey{Channel: a.Key.Channel, CampaignID: a.Key.CampaignID}
+	})
+
+	keys := make([]seriesKey, 0, len(series))
+	for k := range series {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Channel != keys[j].Channel {
+			return keys[i].Channel < keys[j].Channel
+		}
+		return keys[i].CampaignID < keys[j].CampaignID
+	})
+
+	out := []models.Forecast{}
+	for _, k := range keys {
+		pts := series[k]
+		last := pts[len(pts)-1].Date
+		for _, metric := range wanted {
+			y := make([]float64, len(pts))
+			for i, p := range pts {
+				y[i], _ = p.value(metric)
+			}
+			m, err := FitHoltWinters(y, 7)
+			if err != nil {
+				continue // historia insuficiente para esta serie
+			}
+			point, lower, upper := m.Predict(days, z)
+			f := models.Forecast{
+				Channel:    k.Channel,
+				CampaignID: k.CampaignID,
+				Metric:     metric,
+				Model:      "holt_winters",
+				History:    len(y),
+			}
+			if m.Period == 0 {
+				f.Model = "holt"
+			}
+			for i := range point {
+				// costo, leads y revenue no pueden ser negativos
+				f.Points = append(f.Points, models.ForecastPoint{
+					Date:  last.AddDate(0, 0, i+1).Format("2006-01-02"),
+					Value: round2(math.Max(0, point[i])),
+					Lower: round2(math.Max(0, lower[i])),
+					Upper: round2(math.Max(0, upper[i])),
+				})
+			}
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
@@ -5,16 +5,26 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/AngelCh415/ELT_GO/internal/config"
 	"github.com/AngelCh415/ELT_GO/internal/models"
 	"github.com/AngelCh415/ELT_GO/internal/store"
 )
 
-type Service struct{ st *store.MemoryStore }
+type Service struct {
+	st  *store.MemoryStore
+	cfg config.Config
 
-func NewService(st *store.MemoryStore) *Service { return &Service{st: st} }
-func norm(s string) string                      { return strings.ToLower(strings.TrimSpace(s)) }
+	mu        sync.RWMutex
+	anomalies []models.Anomaly
+}
+
+func NewService(st *store.MemoryStore, cfg config.Config) *Service {
+	return &Service{st: st, cfg: cfg}
+}
+func norm(s string) string { return strings.ToLower(strings.TrimSpace(s)) }
 
 func csvSet(s string) map[string]struct{} {
 	out := map[string]struct{}{}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/models"
+)
+
+// Velocity calcula mediana, p75 y p90 (en días) de lead→opportunity y
+// opportunity→closed_won, agrupado por channel, utm_campaign o ambos.
+// Las etapas "first_seen" se descartan: no sabemos cuándo ocurrió la transición.
+func (s *Service) Velocity(v url.Values) ([]models.Velocity, error) {
+	from, _ := time.Parse("2006-01-02", v.Get("from"))
+	to, _ := time.Parse("2006-01-02", v.Get("to"))
+	if to.IsZero() {
+		to = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	}
+	group := norm(v.Get("group"))
+	if group == "" {
+		group = "channel,utm_campaign"
+	}
+	byCh, byUTM := false, false
+	for g := range csvSet(group) {
+		switch g {
+		case "channel":
+			byCh = true
+		case "utm_campaign":
+			byUTM = true
+		default:
+			return nil, errors.New("group must be channel, utm_campaign or both")
+		}
+	}
+	chSet := csvSet(v.Get("channel"))
+	utmC := norm(v.Get("utm_campaign"))
+
+	opps := s.st.Opportunities(from, to, func(o models.OpportunityLifecycle) bool {
+		if len(chSet) > 0 {
+			if _, ok := chSet[norm(o.Channel)]; !ok {
+				return false
+			}
+		}
+		return utmC == "" || norm(o.UTMCampaign) == utmC
+	})
+
+	type key struct{ ch, utm string }
+	type acc struct{ l2o, o2w []float64 }
+	groups := map[key]*acc{}
+	for _, o := range opps {
+		k := key{}
+		if byCh {
+			k.ch = o.Channel
+		}
+		if byUTM {
+			k.utm = o.UTMCampaign
+		}
+		a, ok := groups[k]
+		if !ok {
+			a = &acc{}
+			groups[k] = a
+		}
+		lead, okL := stageTime(o, "lead")
+		opp, okO := stageTime(o, "opportunity")
+		won, okW := stageTime(o, "closed_won")
+		if okL && okO && !opp.Before(lead) {
+			a.l2o = append(a.l2o, opp.Sub(lead).Hours()/24)
+		}
+		if okO && okW && !won.Before(opp) {
+			a.o2w = append(a.o2w, won.Sub(opp).Hours()/24)
+		}
+	}
+
+	out := make([]models.Velocity, 0, len(groups))
+	for k, a := range groups {
+		out = append(out, models.Velocity{
+			Channel:     k.ch,
+			UTMCampaign: k.utm,
+			LeadToOpp:   durationStats(a.l2o),
+			OppToWon:    durationStats(a.o2w),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Channel != out[j].Channel {
+			return out[i].Channel < out[j].Channel
+		}
+		return out[i].UTMCampaign < out[j].UTMCampaign
+	})
+	return out, nil
+}
+
+func stageTime(o models.OpportunityLifecycle, stage string) (time.Time, bool) {
+	t, ok := o.StageAt[stage]
+	if !ok || o.StageSource[stage] == "first_seen" {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func durationStats(days []float64) models.DurationStats {
+	st := models.DurationStats{Count: len(days)}
+	if len(days) == 0 {
+		return st
+	}
+	sort.Float64s(days)
+	st.MedianDays = round2(percentile(days, 0.5))
+	st.P75Days = round2(percentile(days, 0.75))
+	st.P90Days = round2(percentile(days, 0.9))
+	return st
+}
+
+// percentile con interpolación lineal sobre una muestra ordenada.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	pos := p * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
@@ -0,0 +1,232 @@
+// Package mocksrc genera datos sintéticos de Ads y CRM con la forma que
+// consume ingest (adsResp / crmResp) y los sirve con fallas inyectables. Lo
+// usan cmd/mocksources y los tests de integración.
+package mocksrc
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+type AdsRow struct {
+	Date        string  `json:"date"`
+	CampaignID  string  `json:"campaign_id"`
+	Channel     string  `json:"channel"`
+	Clicks      int     `json:"clicks"`
+	Impressions int     `json:"impressions"`
+	Cost        float64 `json:"cost"`
+	UTMCampaign string  `json:"utm_campaign"`
+	UTMSource   string  `json:"utm_source"`
+	UTMMedium   string  `json:"utm_medium"`
+}
+
+type StageChange struct {
+	Stage     string `json:"stage"`
+	ChangedAt string `json:"changed_at"`
+}
+
+type CRMRow struct {
+	OpportunityID  string        `json:"opportunity_id"`
+	ContactEmail   string        `json:"contact_email"`
+	Stage          string        `json:"stage"`
+	Amount         float64       `json:"amount"`
+	CreatedAt      string        `json:"created_at"`
+	UpdatedAt      string        `json:"updated_at,omitempty"`
+	ClosedAt       string        `json:"closed_at,omitempty"`
+	UTMCampaign    string        `json:"utm_campaign"`
+	UTMSource      string        `json:"utm_source"`
+	UTMMedium      string        `json:"utm_medium"`
+	StageChangedAt string        `json:"stage_changed_at,omitempty"`
+	StageHistory   []StageChange `json:"stage_history,omitempty"`
+}
+
+// GenConfig controla el volumen y las tasas. Los valores se usan tal cual
+// (una tasa en 0 = sin conversiones); DefaultGenConfig trae los defaults.
+type GenConfig struct {
+	Seed       int64
+	Start      time.Time // primer día (UTC); cero = hoy - Days
+	Days       int
+	Channels   []string
+	Campaigns  int     // campañas por canal
+	Clicks     int     // clicks medios por campaña y día
+	CTR        float64 // clicks / impresiones (> 0)
+	CPC        float64
+	LeadRate   float64 // click → lead
+	OppRate    float64 // lead → opportunity
+	WinRate    float64 // opportunity → closed_won
+	DealSize   float64
+	Noise      float64 // ruido relativo (0.2 = ±20%); se limita a [0, MaxNoise]
+	BadRows    float64 // fracción de filas inválidas (fechas rotas, negativos)
+	MissingUTM float64 // fracción de filas sin UTMs
+}
+
+// MaxNoise es el ruido máximo: con ±100% un valor puede quedar en 0 y el CTR
+// ruidoso daría impresiones infinitas.
+const MaxNoise = 0.9
+
+// DefaultGenConfig es la configuración de cmd/mocksources sin flags.
+func DefaultGenConfig() GenConfig {
+	return GenConfig{
+		Seed:       42,
+		Days:       14,
+		Channels:   []string{"google_ads", "meta_ads", "tiktok_ads"},
+		Campaigns:  2,
+		Clicks:     200,
+		CTR:        0.03,
+		CPC:        0.6,
+		LeadRate:   0.05,
+		OppRate:    0.3,
+		WinRate:    0.4,
+		DealSize:   1200,
+		Noise:      0.2,
+		BadRows:    0.02,
+		MissingUTM: 0.05,
+	}
+}
+
+// Data es un conjunto generado: mismo seed y config => mismos datos.
+type Data struct {
+	Ads []AdsRow
+	CRM []CRMRow
+}
+
+var sources = map[string][2]string{ // canal → utm_source, utm_medium
+	"google_ads": {"google", "cpc"},
+	"meta_ads":   {"facebook", "paid_social"},
+	"tiktok_ads": {"tiktok", "paid_social"},
+}
+
+func Generate(cfg GenConfig) Data {
+	if cfg.Start.IsZero() {
+		cfg.Start = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -cfg.Days)
+	}
+	cfg.Noise = math.Min(math.Max(cfg.Noise, 0), MaxNoise)
+	rnd := rand.New(rand.NewSource(cfg.Seed))
+	noisy := func(v float64) float64 {
+		return math.Max(0, v*(1+cfg.Noise*(2*rnd.Float64()-1)))
+	}
+
+	var d Data
+	opp := 0
+	for day := 0; day < cfg.Days; day++ {
+		date := cfg.Start.AddDate(0, 0, day)
+		for _, ch := range cfg.Channels {
+			src, ok := sources[ch]
+			if !ok {
+				src = [2]string{ch, "paid"}
+			}
+			for c := 1; c <= cfg.Campaigns; c++ {
+				utmC := fmt.Sprintf("%s_campaign_%d", ch, c)
+				clicks := int(math.Round(noisy(float64(cfg.Clicks))))
+				row := AdsRow{
+					Date:        date.Format("2006-01-02"),
+					CampaignID:  fmt.Sprintf("%s-C%d", ch, c),
+					Channel:     ch,
+					Clicks:      clicks,
+					Impressions: impressions(clicks, noisy(cfg.CTR)),
+					Cost:        math.Round(float64(clicks)*noisy(cfg.CPC)*100) / 100,
+					UTMCampaign: utmC,
+					UTMSource:   src[0],
+					UTMMedium:   src[1],
+				}
+				missing := rnd.Float64() < cfg.MissingUTM
+				if missing {
+					row.UTMCampaign, row.UTMSource, row.UTMMedium = "", "", ""
+				}
+				d.Ads = append(d.Ads, corruptAds(rnd, cfg.BadRows, row))
+
+				leads := int(math.Round(noisy(float64(clicks) * cfg.LeadRate)))
+				for l := 0; l < leads; l++ {
+					opp++
+					o := lead(rnd, cfg, opp, date, utmC, src)
+					if missing || rnd.Float64() < cfg.MissingUTM {
+						o.UTMCampaign, o.UTMSource, o.UTMMedium = "", "", ""
+					}
+					d.CRM = append(d.CRM, corruptCRM(rnd, cfg.BadRows, o))
+				}
+			}
+		}
+	}
+	return d
+}
+
+// impressions deriva las impresiones de los clicks; sin CTR no hay datos
+// para estimarlas y se reportan iguales a los clicks.
+func impressions(clicks int, ctr float64) int {
+	if ctr <= 0 {
+		return clicks
+	}
+	return int(math.Round(float64(clicks) / ctr))
+}
+
+// lead arma una oportunidad creada en date y la avanza por el funnel.
+func lead(rnd *rand.Rand, cfg GenConfig, n int, date time.Time, utmC string, src [2]string) CRMRow {
+	created := date.Add(time.Duration(rnd.Intn(24*60)) * time.Minute)
+	o := CRMRow{
+		OpportunityID: fmt.Sprintf("O-%05d", n),
+		ContactEmail:  fmt.Sprintf("lead%05d@example.com", n),
+		Stage:         "lead",
+		CreatedAt:     created.Format(time.RFC3339),
+		UTMCampaign:   utmC,
+		UTMSource:     src[0],
+		UTMMedium:     src[1],
+	}
+	hist := []StageChange{{Stage: "lead", ChangedAt: o.CreatedAt}}
+	at := created
+	advance := func(stage string) {
+		at = at.Add(time.Duration(1+rnd.Intn(72)) * time.Hour)
+		o.Stage = stage
+		hist = append(hist, StageChange{Stage: stage, ChangedAt: at.Format(time.RFC3339)})
+	}
+	if rnd.Float64() < cfg.OppRate {
+		advance("opportunity")
+		if rnd.Float64() < cfg.WinRate {
+			advance("closed_won")
+			o.Amount = math.Round(cfg.DealSize*(0.5+rnd.Float64())*100) / 100
+		} else if rnd.Float64() < 0.5 {
+			advance("closed_lost")
+		}
+	}
+	o.UpdatedAt = at.Format(time.RFC3339)
+	o.StageChangedAt = o.UpdatedAt
+	if o.Stage == "closed_won" || o.Stage == "closed_lost" {
+		o.ClosedAt = o.UpdatedAt
+	}
+	// sólo algunos CRMs exponen el historial completo
+	if rnd.Intn(2) == 0 {
+		o.StageHistory = hist
+	}
+	return o
+}
+
+func corruptAds(rnd *rand.Rand, rate float64, r AdsRow) AdsRow {
+	if rnd.Float64() >= rate {
+		return r
+	}
+	switch rnd.Intn(3) {
+	case 0:
+		r.Date = "2025-13-45"
+	case 1:
+		r.Clicks, r.Cost = -r.Clicks, -r.Cost
+	default:
+		r.Date = ""
+	}
+	return r
+}
+
+func corruptCRM(rnd *rand.Rand, rate float64, o CRMRow) CRMRow {
+	if rnd.Float64() >= rate {
+		return o
+	}
+	switch rnd.Intn(3) {
+	case 0:
+		o.CreatedAt = ""
+	case 1:
+		o.CreatedAt = "not-a-date"
+	default:
+		o.Amount = -o.Amount - 1
+	}
+	return o
+}
@@ -0,0 +1,80 @@
+package mocksrc
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Faults son fallas inyectadas por request; las tasas van de 0 a 1.
+type Faults struct {
+	Latency      time.Duration // demora fija antes de responder
+	Jitter       time.Duration // demora extra aleatoria [0, Jitter)
+	ErrorRate    float64       // responde 503
+	TruncateRate float64       // corta el JSON a la mitad
+	FailFirst    int           // los primeros N requests de cada endpoint dan 503
+}
+
+// Server sirve /ads y /crm con los datos generados.
+type Server struct {
+	data   Data
+	faults Faults
+
+	mu    sync.Mutex
+	rnd   *rand.Rand
+	calls map[string]int
+}
+
+func NewServer(d Data, f Faults, seed int64) *Server {
+	return &Server{data: d, faults: f, rnd: rand.New(rand.NewSource(seed)), calls: map[string]int{}}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := chi.NewRouter()
+	mux.Get("/healthz", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	mux.Get("/ads", func(w http.ResponseWriter, r *http.Request) { s.serve(w, r, "ads", s.data.Ads) })
+	mux.Get("/crm", func(w http.ResponseWriter, r *http.Request) { s.serve(w, r, "crm", s.data.CRM) })
+	return mux
+}
+
+// Calls devuelve cuántos requests recibió el endpoint ("ads" | "crm").
+func (s *Server) Calls(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[endpoint]
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, endpoint string, v any) {
+	s.mu.Lock()
+	s.calls[endpoint]++
+	n := s.calls[endpoint]
+	delay := s.faults.Latency
+	if s.faults.Jitter > 0 {
+		delay += time.Duration(s.rnd.Int63n(int64(s.faults.Jitter)))
+	}
+	fail := n <= s.faults.FailFirst || s.rnd.Float64() < s.faults.ErrorRate
+	truncate := s.rnd.Float64() < s.faults.TruncateRate
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if fail {
+		http.Error(w, "injected failure", http.StatusServiceUnavailable)
+		return
+	}
+	b, _ := json.Marshal(v)
+	if truncate {
+		b = b[:len(b)/2]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
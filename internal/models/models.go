@@ -20,9 +20,33 @@ type Opportunity struct {
 	Stage         string // e.g., lead, opportunity, closed_won, closed_lost
 	Amount        float64
 	CreatedAt     time.Time
-	UTMCampaign   string
-	UTMSource     string
-	UTMMedium     string
+	UpdatedAt     time.Time // opcional (CRM updated_at)
+	ClosedAt      time.Time // opcional (CRM closed_at)
+	// opcionales: hora del último cambio de etapa e historial completo del CRM
+	StageChangedAt time.Time
+	StageHistory   map[string]time.Time
+	UTMCampaign    string
+	UTMSource      string
+	UTMMedium      string
+}
+
+// OpportunityLifecycle es el historial de una oportunidad a través de las
+// ingestas: StageAt guarda cuándo se vio (o el CRM reportó) cada etapa y
+// StageSource de dónde salió esa hora (crm | observed | first_seen).
+type OpportunityLifecycle struct {
+	Key         string
+	CreatedAt   time.Time
+	Stage       string
+	Amount      float64
+	Channel     string
+	CampaignID  string
+	UTMCampaign string
+	UTMSource   string
+	UTMMedium   string
+	StageAt     map[string]time.Time
+	StageSource map[string]string
+	FirstSeen   time.Time
+	LastSeen    time.Time
 }
 type DailyAggKey struct {
 	Date        time.Time
@@ -62,3 +86,217 @@ type Metrics struct {
 	CVROppToWon   float64 `json:"cvr_opp_to_won"`
 	ROAS          float64 `json:"roas"`
 }
+
+// Anomaly es un punto de la serie diaria fuera del rango esperado.
+type Anomaly struct {
+	Date       string  `json:"date"`
+	Channel    string  `json:"channel"`
+	CampaignID string  `json:"campaign_id"`
+	Metric     string  `json:"metric"`
+	Observed   float64 `json:"observed"`
+	Expected   float64 `json:"expected"`
+	Lower      float64 `json:"lower"`
+	Upper      float64 `json:"upper"`
+	Score      float64 `json:"score"`
+	Direction  string  `json:"direction"` // "drop" | "spike"
+}
+
+type ForecastPoint struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+}
+
+// Forecast es la proyección de una métrica para un canal o campaña.
+type Forecast struct {
+	Channel    string          `json:"channel"`
+	CampaignID string          `json:"campaign_id,omitempty"`
+	Metric     string          `json:"metric"`
+	Model      string          `json:"model"`
+	History    int             `json:"history_days"`
+	Points     []ForecastPoint `json:"points"`
+}
+
+// Budget es un presupuesto mensual o por flight para una campaña o canal.
+type Budget struct {
+	ID         string  `json:"id"`
+	CampaignID string  `json:"campaign_id,omitempty"`
+	Channel    string  `json:"channel,omitempty"`
+	Amount     float64 `json:"amount"`
+	Period     string  `json:"period"`          // "monthly" | "flight"
+	Month      string  `json:"month,omitempty"` // YYYY-MM (monthly)
+	Start      string  `json:"start"`           // YYYY-MM-DD
+	End        string  `json:"end"`             // YYYY-MM-DD (inclusive)
+	// pesos por día de la semana (domingo..sábado); vacío = lineal
+	WeekdayWeights []float64 `json:"weekday_weights,omitempty"`
+	Threshold      float64   `json:"threshold,omitempty"` // 0 = usa BUDGET_PACING_THRESHOLD
+}
+
+type Pacing struct {
+	BudgetID       string  `json:"budget_id"`
+	CampaignID     string  `json:"campaign_id,omitempty"`
+	Channel        string  `json:"channel,omitempty"`
+	Start          string  `json:"start"`
+	End            string  `json:"end"`
+	AsOf           string  `json:"as_of"`
+	Amount         float64 `json:"amount"`
+	SpentToDate    float64 `json:"spent_to_date"`
+	ExpectedToDate float64 `json:"expected_to_date"`
+	PacingRatio    float64 `json:"pacing_ratio"`
+	ProjectedSpend float64 `json:"projected_spend"`
+	Deviation      float64 `json:"deviation"` // (proyectado - presupuesto) / presupuesto
+	Status         string  `json:"status"`    // on_track | over | under | not_started | ended
+}
+
+// AlertRule define una condición evaluada después de cada ingesta.
+//   - type "threshold": Metric agregado en los últimos WindowDays (Op Threshold)
+//   - type "no_data":   sin filas de Source ("ads" | "crm") para ayer
+type AlertRule struct {
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	Type            string  `json:"type"`
+	Metric          string  `json:"metric,omitempty"` // cpa, cpc, roas, cost, clicks, impressions, leads, opportunities, closed_won, revenue
+	Channel         string  `json:"channel,omitempty"`
+	CampaignID      string  `json:"campaign_id,omitempty"`
+	WindowDays      int     `json:"window_days,omitempty"`
+	Op              string  `json:"op,omitempty"` // > >= < <=
+	Threshold       float64 `json:"threshold,omitempty"`
+	Source          string  `json:"source,omitempty"`
+	CooldownMinutes int     `json:"cooldown_minutes,omitempty"` // 0 = ALERT_COOLDOWN
+	Disabled        bool    `json:"disabled,omitempty"`
+}
+
+// AlertEvent es el payload enviado al webhook y el estado expuesto en /alerts.
+type AlertEvent struct {
+	RuleID      string    `json:"rule_id"`
+	RuleName    string    `json:"rule_name"`
+	Status      string    `json:"status"` // firing | resolved
+	Metric      string    `json:"metric,omitempty"`
+	Channel     string    `json:"channel,omitempty"`
+	CampaignID  string    `json:"campaign_id,omitempty"`
+	Value       float64   `json:"value"`
+	Threshold   float64   `json:"threshold"`
+	Message     string    `json:"message"`
+	StartsAt    time.Time `json:"starts_at"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+}
+
+type CohortBucket struct {
+	Days       int     `json:"days"`
+	ClosedWon  int     `json:"closed_won"`
+	Conversion float64 `json:"conversion"`
+	Revenue    float64 `json:"revenue"`
+	Complete   bool    `json:"complete"` // toda la cohorte ya tiene esa edad
+}
+
+// Cohort agrupa los leads creados en una semana o mes.
+type Cohort struct {
+	Cohort  string         `json:"cohort"` // inicio del periodo (YYYY-MM-DD)
+	Leads   int            `json:"leads"`
+	Buckets []CohortBucket `json:"buckets"`
+}
+
+type DurationStats struct {
+	Count      int     `json:"count"`
+	MedianDays float64 `json:"median_days"`
+	P75Days    float64 `json:"p75_days"`
+	P90Days    float64 `json:"p90_days"`
+}
+
+// Velocity son los tiempos entre etapas para un canal / utm_campaign.
+type Velocity struct {
+	Channel     string        `json:"channel,omitempty"`
+	UTMCampaign string        `json:"utm_campaign,omitempty"`
+	LeadToOpp   DurationStats `json:"lead_to_opportunity"`
+	OppToWon    DurationStats `json:"opportunity_to_closed_won"`
+}
+
+// ExportFilter restringe las filas exportadas (vacío = sin filtro).
+type ExportFilter struct {
+	Channel     string `json:"channel,omitempty"` // CSV
+	UTMCampaign string `json:"utm_campaign,omitempty"`
+	UTMSource   string `json:"utm_source,omitempty"`
+	UTMMedium   string `json:"utm_medium,omitempty"`
+}
+
+type ExportBatch struct {
+	Seq      int    `json:"seq"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Rows     int    `json:"rows"`
+	Status   string `json:"status"` // pending | done | unchanged | failed
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+	// estado por sink: delivered | unchanged | retrying | dead
+	Sinks    map[string]string `json:"sinks,omitempty"`
+	Versions map[string]int    `json:"versions,omitempty"` // versión de cada día del lote
+	Part     string            `json:"part"`               // archivo dentro de la partición del día (ver export.Batch)
+	Data     []Metrics         `json:"-"`                  // snapshot: un resume reenvía exactamente lo mismo
+	Aggs     []DailyAgg        `json:"-"`
+}
+
+// IngestReport es el resultado de una corrida de ingesta, por fuente.
+type IngestReport struct {
+	Status        string         `json:"status"`         // ok | partial | failed
+	PartialCommit bool           `json:"partial_commit"` // se guardan las fuentes que anduvieron aunque otra falle
+	Sources       []SourceResult `json:"sources"`
+	StartedAt     time.Time      `json:"started_at"`
+	DurationMS    int64          `json:"duration_ms"`
+}
+
+// SourceResult cuenta las filas de una fuente en una corrida; Error viene si
+// falló (o se canceló) su descarga.
+type SourceResult struct {
+	Source     string `json:"source"`
+	Fetched    int    `json:"fetched"` // filas descargadas
+	Accepted   int    `json:"accepted"`
+	Duplicates int    `json:"duplicates"`
+	Rejected   int    `json:"rejected"`
+	Filtered   int    `json:"filtered"` // anteriores a since
+	Committed  bool   `json:"committed"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ExportJob es una exportación de rango partida en lotes; si falla un lote se
+// puede reanudar desde el primero no entregado.
+type ExportJob struct {
+	ID        string        `json:"id"`
+	From      string        `json:"from"`
+	To        string        `json:"to"`
+	Filter    ExportFilter  `json:"filter"`
+	BatchRows int           `json:"batch_rows,omitempty"` // 0 = un lote por día
+	Force     bool          `json:"force,omitempty"`      // reenvía aunque el contenido no cambió
+	Status    string        `json:"status"`               // running | done | failed
+	Exported  int           `json:"exported"`
+	Skipped   int           `json:"skipped"`           // filas sin cambios desde la última entrega
+	Trigger   string        `json:"trigger,omitempty"` // "change" si lo lanzó un cambio de datos
+	Batches   []ExportBatch `json:"batches"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// LedgerEntry registra una entrega (o intento) de un lote a un sink: el
+// outbox de exportación. DayHashes guarda el hash del contenido de cada día
+// enviado; Data/Aggs, el payload para los reintentos.
+type LedgerEntry struct {
+	ID            string            `json:"id"`
+	Day           string            `json:"day"`
+	To            string            `json:"to"`
+	Seq           int               `json:"seq"`
+	Sink          string            `json:"sink"`
+	Hash          string            `json:"payload_hash"`
+	DayHashes     map[string]string `json:"day_hashes"`
+	Rows          int               `json:"rows"`
+	Attempts      int               `json:"attempts"`
+	Status        string            `json:"status"`                  // sending | delivered | retrying | dead | superseded
+	ResponseCode  int               `json:"response_code,omitempty"` // código del destino cuando rechazó el envío
+	Error         string            `json:"error,omitempty"`
+	Versions      map[string]int    `json:"versions,omitempty"`
+	Part          string            `json:"part"`
+	NextAttemptAt time.Time         `json:"next_attempt_at"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	Data          []Metrics         `json:"-"`
+	Aggs          []DailyAgg        `json:"-"`
+}
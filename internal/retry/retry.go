@@ -0,0 +1,161 @@
+// Package retry es la política de reintentos de las llamadas salientes
+// (fuentes ADS/CRM, sinks y webhook de alertas).
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy reintenta con backoff exponencial y full jitter: el intento n espera
+// un valor al azar en [0, min(MaxDelay, BaseDelay*2^(n-1))).
+type Policy struct {
+	MaxAttempts int           // intentos totales; <= 1 = sin reintentos
+	BaseDelay   time.Duration // 0 = 100ms
+	MaxDelay    time.Duration // tope del backoff; un Retry-After mayor corta los reintentos. 0 = sin tope
+	// Retryable decide por código HTTP; nil = RetryableStatus
+	Retryable func(code int) bool
+}
+
+// RetryableStatus: 408, 425, 429 y 5xx. El resto de 4xx no se reintenta.
+func RetryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests:
+		return true
+	}
+	return code >= 500
+}
+
+// StatusError es una respuesta no-2xx; RetryAfter sale del header Retry-After.
+type StatusError struct {
+	Code       int
+	Status     string
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string             { return e.Status }
+func (e *StatusError) HTTPStatus() int           { return e.Code }
+func (e *StatusError) RetryDelay() time.Duration { return e.RetryAfter }
+
+// FromResponse devuelve nil para 2xx o un *StatusError con Retry-After.
+func FromResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return &StatusError{Code: resp.StatusCode, Status: resp.Status,
+		RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())}
+}
+
+// ParseRetryAfter acepta segundos o fecha HTTP; inválido o vencido = 0.
+func ParseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		if n < 0 {
+			return 0
+		}
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+type permanent struct{ err error }
+
+func (p permanent) Error() string { return p.err.Error() }
+func (p permanent) Unwrap() error { return p.err }
+
+// Permanent marca un error que no se debe reintentar (p. ej. JSON inválido).
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanent{err}
+}
+
+// Do llama fn (attempt empieza en 1) hasta que devuelva nil, un error no
+// reintentable o se agoten los intentos. Cancelar ctx corta la espera.
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context, attempt int) error) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for i := 1; ; i++ {
+		err = fn(ctx, i)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		var perm permanent
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		wait, ok := p.next(err, i)
+		if !ok || i >= attempts {
+			return err
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-t.C:
+		}
+	}
+}
+
+// next clasifica err y calcula la espera antes del intento attempt+1.
+func (p Policy) next(err error, attempt int) (time.Duration, bool) {
+	wait := p.Delay(attempt)
+	// errores con código HTTP (StatusError de este paquete o de export)
+	var sc interface{ HTTPStatus() int }
+	if errors.As(err, &sc) {
+		retryable := p.Retryable
+		if retryable == nil {
+			retryable = RetryableStatus
+		}
+		if !retryable(sc.HTTPStatus()) {
+			return 0, false
+		}
+	}
+	// Retry-After (también de export.StatusError): se espera al menos eso. Si
+	// pasa de MaxDelay no se reintenta antes de tiempo: se devuelve el error,
+	// que lo lleva, para que el llamador reprograme (p. ej. el ledger)
+	var ra interface{ RetryDelay() time.Duration }
+	if errors.As(err, &ra) && ra.RetryDelay() > wait {
+		if p.MaxDelay > 0 && ra.RetryDelay() > p.MaxDelay {
+			return 0, false
+		}
+		wait = ra.RetryDelay()
+	}
+	return wait, true
+}
+
+// Delay es la espera con full jitter tras el intento attempt (desde 1).
+func (p Policy) Delay(attempt int) time.Duration {
+	base := p.BaseDelay
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+	ceil := base
+	for i := 1; i < attempt && i < 32 && (p.MaxDelay <= 0 || ceil < p.MaxDelay); i++ {
+		ceil *= 2
+	}
+	if p.MaxDelay > 0 && ceil > p.MaxDelay {
+		ceil = p.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(ceil)))
+}
@@ -0,0 +1,360 @@
+// Package sinkrecv es un receptor de referencia para el sink http: verifica
+// la firma, rechaza repeticiones, deduplica por Idempotency-Key, descarta
+// versiones viejas y guarda lo aceptado. Lo usan cmd/sink y los tests.
+package sinkrecv
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/AngelCh415/ELT_GO/pkg/signature"
+)
+
+const maxBody = 64 << 20
+
+type Config struct {
+	Keys      map[string]string // id → secret aceptados
+	Dir       string            // "" = sólo en memoria
+	Tolerance time.Duration     // 0 = signature.DefaultTolerance
+}
+
+// Received es un request aceptado (o reconocido como duplicado / viejo).
+type Received struct {
+	ID             int            `json:"id"`
+	IdempotencyKey string         `json:"idempotency_key"`
+	KeyID          string         `json:"key_id"`
+	ContentType    string         `json:"content_type"`
+	Gzip           bool           `json:"gzip,omitempty"`
+	Versions       map[string]int `json:"versions,omitempty"`
+	Chunk          string         `json:"chunk,omitempty"`
+	Manifest       bool           `json:"manifest,omitempty"`
+	Bytes          int            `json:"bytes"`
+	Rows           int            `json:"rows"`
+	Status         string         `json:"status"` // stored | duplicate | stale
+	File           string         `json:"file,omitempty"`
+	ReceivedAt     time.Time      `json:"received_at"`
+
+	body []byte
+}
+
+type Receiver struct {
+	cfg Config
+	log *slog.Logger
+
+	mu       sync.Mutex
+	items    []Received
+	byKey    map[string]int       // Idempotency-Key → índice en items
+	sigs     map[string]time.Time // firmas vistas → vencimiento (anti-replay)
+	versions map[string]int       // última versión aceptada por día
+}
+
+func New(cfg Config, log *slog.Logger) *Receiver {
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = signature.DefaultTolerance
+	}
+	return &Receiver{cfg: cfg, log: log, byKey: map[string]int{}, sigs: map[string]time.Time{}, versions: map[string]int{}}
+}
+
+// Handler: POST en cualquier ruta recibe; GET /received lista, GET
+// /received/{id} devuelve el payload y DELETE /received limpia.
+func (rv *Receiver) Handler() http.Handler {
+	mux := chi.NewRouter()
+	mux.Get("/healthz", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	mux.Get("/received", func(w http.ResponseWriter, r *http.Request) { writeJSON(w, 200, rv.Received()) })
+	mux.Get("/received/{id}", rv.get)
+	mux.Delete("/received", func(w http.ResponseWriter, r *http.Request) {
+		rv.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.Post("/*", rv.receive)
+	return mux
+}
+
+// Received devuelve una copia de lo recibido, en orden de llegada.
+func (rv *Receiver) Received() []Received {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	return append([]Received{}, rv.items...)
+}
+
+// Body devuelve el payload guardado (descomprimido si venía con gzip).
+func (rv *Receiver) Body(id int) ([]byte, bool) {
+	rec, ok := rv.item(id)
+	return rec.body, ok
+}
+
+// item copia una recepción bajo el lock: un DELETE concurrente puede vaciar
+// items entre dos lecturas.
+func (rv *Receiver) item(id int) (Received, bool) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	if id < 1 || id > len(rv.items) {
+		return Received{}, false
+	}
+	return rv.items[id-1], true
+}
+
+func (rv *Receiver) Reset() {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	rv.items = nil
+	rv.byKey = map[string]int{}
+	rv.sigs = map[string]time.Time{}
+	rv.versions = map[string]int{}
+}
+
+func (rv *Receiver) receive(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	now := time.Now()
+	if err := signature.Verify(r.Header, body, rv.cfg.Keys, rv.cfg.Tolerance, now); err != nil {
+		rv.log.Warn("sink rejected", slog.String("err", err.Error()))
+		http.Error(w, err.Error(), 401)
+		return
+	}
+	if r.Header.Get("X-Export-Versions") != "" && !signature.Covers(r.Header, "X-Export-Versions") {
+		http.Error(w, "unsigned X-Export-Versions", 401)
+		return
+	}
+	versions, err := parseVersions(r.Header.Get("X-Export-Versions"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	gz := r.Header.Get("Content-Encoding") == "gzip"
+	plain := body
+	if gz {
+		if plain, err = gunzip(body); err != nil {
+			http.Error(w, "bad gzip: "+err.Error(), 400)
+			return
+		}
+	}
+
+	rec := Received{
+		IdempotencyKey: r.Header.Get("Idempotency-Key"),
+		KeyID:          r.Header.Get(signature.HeaderKeyID),
+		ContentType:    r.Header.Get("Content-Type"),
+		Gzip:           gz,
+		Versions:       versions,
+		Chunk:          r.Header.Get("X-Export-Chunk"),
+		Manifest:       r.Header.Get("X-Export-Manifest") == "true",
+		Bytes:          len(body),
+		Rows:           countRows(rowsKind(r), plain),
+		ReceivedAt:     now.UTC(),
+		body:           plain,
+	}
+
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+
+	// una firma sólo vale una vez dentro de la ventana de tolerancia; la
+	// excepción es un lote ya guardado (un reintento en el mismo segundo es
+	// idéntico byte a byte y no tiene efecto)
+	for s, exp := range rv.sigs {
+		if now.After(exp) {
+			delete(rv.sigs, s)
+		}
+	}
+	sig := r.Header.Get(signature.HeaderSignature)
+	if _, seen := rv.sigs[sig]; seen && (rec.IdempotencyKey == "" || !rv.has(rec.IdempotencyKey)) {
+		http.Error(w, "replayed signature", 409)
+		return
+	}
+	rv.sigs[sig] = now.Add(2 * rv.cfg.Tolerance)
+
+	if rec.Manifest {
+		if missing := rv.missingChunks(plain); len(missing) > 0 {
+			http.Error(w, "missing chunks: "+strings.Join(missing, ","), 422)
+			return
+		}
+	}
+
+	switch {
+	case rec.IdempotencyKey != "" && rv.has(rec.IdempotencyKey):
+		rec.Status = "duplicate"
+		w.Header().Set("Idempotent-Replayed", "true")
+	case rv.stale(versions):
+		rec.Status = "stale"
+	default:
+		rec.Status = "stored"
+		for d, v := range versions {
+			rv.versions[d] = v
+		}
+		if rv.cfg.Dir != "" {
+			if rec.File, err = rv.save(rec, body); err != nil {
+				http.Error(w, err.Error(), 500)
+				return
+			}
+		}
+	}
+
+	rec.ID = len(rv.items) + 1
+	rv.items = append(rv.items, rec)
+	if rec.Status == "stored" && rec.IdempotencyKey != "" {
+		rv.byKey[rec.IdempotencyKey] = rec.ID - 1
+	}
+	rv.log.Info("sink received", slog.Int("id", rec.ID), slog.String("key", rec.IdempotencyKey),
+		slog.String("status", rec.Status), slog.Int("rows", rec.Rows))
+	writeJSON(w, 200, rec)
+}
+
+func (rv *Receiver) get(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	rec, ok := rv.item(id)
+	if !ok {
+		http.Error(w, "not found", 404)
+		return
+	}
+	w.Header().Set("Content-Type", rec.ContentType)
+	w.Write(rec.body)
+}
+
+func (rv *Receiver) has(key string) bool {
+	_, ok := rv.byKey[key]
+	return ok
+}
+
+// stale: algún día del payload trae una versión menor a la ya aceptada.
+func (rv *Receiver) stale(versions map[string]int) bool {
+	for d, v := range versions {
+		if v < rv.versions[d] {
+			return true
+		}
+	}
+	return false
+}
+
+func (rv *Receiver) missingChunks(manifest []byte) []string {
+	var m struct {
+		Chunks []string `json:"chunks"`
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return []string{"(bad manifest)"}
+	}
+	var out []string
+	for _, c := range m.Chunks {
+		if !rv.has(c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// save guarda el payload tal cual llegó en <dir>/<día>/<clave o id>.<ext>.
+func (rv *Receiver) save(rec Received, body []byte) (string, error) {
+	day := "unknown"
+	for d := range rec.Versions {
+		if day == "unknown" || d < day {
+			day = d
+		}
+	}
+	name := rec.IdempotencyKey
+	if name == "" {
+		name = fmt.Sprintf("req-%d", len(rv.items)+1)
+	}
+	name = strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(name) + ext(rec)
+	dir := filepath.Join(rv.cfg.Dir, day)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	return path, os.WriteFile(path, body, 0o644)
+}
+
+func ext(rec Received) string {
+	e := ".json"
+	switch {
+	case strings.HasPrefix(rec.ContentType, "application/x-ndjson"):
+		e = ".ndjson"
+	case strings.HasPrefix(rec.ContentType, "text/csv"):
+		e = ".csv"
+	}
+	if rec.Gzip {
+		e += ".gz"
+	}
+	return e
+}
+
+// rowsKind es el Content-Type, o "manifest" para el cierre de un lote en chunks.
+func rowsKind(r *http.Request) string {
+	if r.Header.Get("X-Export-Manifest") == "true" {
+		return "manifest"
+	}
+	return r.Header.Get("Content-Type")
+}
+
+// countRows cuenta filas según el formato: arreglo JSON, líneas NDJSON o CSV
+// sin el encabezado. El manifiesto no cuenta.
+func countRows(ct string, b []byte) int {
+	switch {
+	case ct == "manifest":
+		return 0
+	case strings.HasPrefix(ct, "application/x-ndjson"), strings.HasPrefix(ct, "text/csv"):
+		n := 0
+		sc := bufio.NewScanner(bytes.NewReader(b))
+		sc.Buffer(make([]byte, 64*1024), maxBody)
+		for sc.Scan() {
+			if len(bytes.TrimSpace(sc.Bytes())) > 0 {
+				n++
+			}
+		}
+		if strings.HasPrefix(ct, "text/csv") && n > 0 {
+			n--
+		}
+		return n
+	}
+	var rows []json.RawMessage
+	if json.Unmarshal(b, &rows) != nil {
+		return 0
+	}
+	return len(rows)
+}
+
+// parseVersions lee "YYYY-MM-DD=v,..." (X-Export-Versions).
+func parseVersions(h string) (map[string]int, error) {
+	if h == "" {
+		return nil, nil
+	}
+	out := map[string]int{}
+	for _, p := range strings.Split(h, ",") {
+		d, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		n, err := strconv.Atoi(v)
+		if _, derr := time.Parse("2006-01-02", d); !ok || err != nil || derr != nil {
+			return nil, fmt.Errorf("bad X-Export-Versions %q", h)
+		}
+		out[d] = n
+	}
+	return out, nil
+}
+
+func gunzip(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, maxBody))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/models"
+)
+
+// El ledger de exportación vive junto a los agregados para que, con un store
+// durable, datos y outbox se persistan juntos.
+
+type ledgerKey struct {
+	day, sink, part string
+}
+
+// LedgerLast devuelve la entrada más reciente que lleva el día al sink con
+// ese part (filtro).
+func (s *MemoryStore) LedgerLast(day, sink, part string) (models.LedgerEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	id, ok := s.ledgerIdx[ledgerKey{day, sink, part}]
+	if !ok {
+		return models.LedgerEntry{}, false
+	}
+	return *s.ledger[id], true
+}
+
+// LedgerPut inserta (ID vacío) o reemplaza una entrada; devuelve la guardada.
+// El payload sólo se guarda mientras la entrada pueda reintentarse.
+func (s *MemoryStore) LedgerPut(e models.LedgerEntry) models.LedgerEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ledgerFinal(e.Status) {
+		e.Data, e.Aggs = nil, nil
+	}
+	if e.ID == "" {
+		s.ledgerSeq++
+		e.ID = "L-" + strconv.Itoa(s.ledgerSeq)
+		for d := range e.DayHashes {
+			s.ledgerIdx[ledgerKey{d, e.Sink, e.Part}] = e.ID
+		}
+	}
+	c := e
+	s.ledger[e.ID] = &c
+	return e
+}
+
+// LedgerClaimDue marca como "sending" y devuelve las entradas en reintento
+// cuyo NextAttemptAt ya pasó; así dos despachadores no envían lo mismo.
+func (s *MemoryStore) LedgerClaimDue(now time.Time) []models.LedgerEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []models.LedgerEntry
+	for _, e := range s.ledger {
+		if e.Status == "retrying" && !e.NextAttemptAt.After(now) {
+			e.Status = "sending"
+			e.UpdatedAt = now
+			out = append(out, *e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return ledgerNum(out[i].ID) < ledgerNum(out[j].ID) })
+	return out
+}
+
+// LedgerPrune deja como mucho keep entradas terminadas (las más nuevas) y
+// devuelve cuántas borró. Nunca borra pendientes ni la última entrada de un
+// día, que es contra la que se compara el próximo envío.
+func (s *MemoryStore) LedgerPrune(keep int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last := make(map[string]bool, len(s.ledgerIdx))
+	for _, id := range s.ledgerIdx {
+		last[id] = true
+	}
+	var ids []string
+	for id, e := range s.ledger {
+		if ledgerFinal(e.Status) && !last[id] {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) <= keep {
+		return 0
+	}
+	sort.Slice(ids, func(i, j int) bool { return ledgerNum(ids[i]) < ledgerNum(ids[j]) })
+	n := len(ids) - keep
+	for _, id := range ids[:n] {
+		delete(s.ledger, id)
+	}
+	return n
+}
+
+func ledgerFinal(status string) bool {
+	return status == "delivered" || status == "dead" || status == "superseded"
+}
+
+// Ledger lista las entradas (más recientes primero) que pasan el filtro.
+func (s *MemoryStore) Ledger(f func(models.LedgerEntry) bool) []models.LedgerEntry {
+	s.mu.RLock()
+	out := make([]models.LedgerEntry, 0, len(s.ledger))
+	for _, e := range s.ledger {
+		if f == nil || f(*e) {
+			out = append(out, *e)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return ledgerNum(out[i].ID) > ledgerNum(out[j].ID) })
+	return out
+}
+
+func ledgerNum(id string) int {
+	n, _ := strconv.Atoi(id[2:])
+	return n
+}
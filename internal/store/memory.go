@@ -12,18 +12,49 @@ type MemoryStore struct {
 	mu   sync.RWMutex
 	agg  map[models.DailyAggKey]*models.DailyAgg
 	seen map[string]struct{} // idempotencia por-record
+	opps map[string]*models.OpportunityLifecycle
+
+	ledger    map[string]*models.LedgerEntry
+	ledgerIdx map[ledgerKey]string // última entrada por día + sink + part
+	ledgerSeq int
+
+	rev      map[string]int // revisión por día (YYYY-MM-DD)
+	exported map[string]int // última revisión exportada completa
 }
 
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
 		agg:  make(map[models.DailyAggKey]*models.DailyAgg),
 		seen: make(map[string]struct{}),
+		opps: make(map[string]*models.OpportunityLifecycle),
+
+		ledger:    make(map[string]*models.LedgerEntry),
+		ledgerIdx: make(map[ledgerKey]string),
+
+		rev:      make(map[string]int),
+		exported: make(map[string]int),
 	}
 }
 
 func (s *MemoryStore) MarkSeen(key string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.markSeen(key)
+}
+
+// MarkSeenBatch es MarkSeen para varias claves en orden, con un solo lock: una
+// clave repetida dentro del lote solo es nueva la primera vez.
+func (s *MemoryStore) MarkSeenBatch(keys []string) []bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]bool, len(keys))
+	for i, k := range keys {
+		out[i] = s.markSeen(k)
+	}
+	return out
+}
+
+func (s *MemoryStore) markSeen(key string) bool {
 	if _, ok := s.seen[key]; ok {
 		return false
 	}
@@ -32,6 +63,21 @@ func (s *MemoryStore) MarkSeen(key string) bool {
 }
 
 func (s *MemoryStore) UpsertAds(a models.AdsPerformance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upsertAds(a)
+}
+
+// UpsertAdsBatch es UpsertAds para un lote completo con un solo lock.
+func (s *MemoryStore) UpsertAdsBatch(rows []models.AdsPerformance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range rows {
+		s.upsertAds(a)
+	}
+}
+
+func (s *MemoryStore) upsertAds(a models.AdsPerformance) {
 	k := models.DailyAggKey{
 		Date:        day(a.Date),
 		Channel:     a.Channel,
@@ -40,8 +86,6 @@ func (s *MemoryStore) UpsertAds(a models.AdsPerformance) {
 		UTMSource:   a.UTMSource,
 		UTMMedium:   a.UTMMedium,
 	}
-	s.mu.Lock()
-	defer s.mu.Unlock()
 	agg, ok := s.agg[k]
 	if !ok {
 		agg = &models.DailyAgg{Key: k}
@@ -50,18 +94,27 @@ func (s *MemoryStore) UpsertAds(a models.AdsPerformance) {
 	agg.Clicks += max0(a.Clicks)
 	agg.Impressions += max0(a.Impressions)
 	agg.Cost += maxf(a.Cost)
+	s.touch(k.Date)
 }
 
 // findAggByUTM busca un agregado del MISMO día con el mismo triple UTM.
-// Prioriza el que tenga Channel/CampaignID (típicamente, el de Ads).
+// Prioriza el que tenga Channel/CampaignID (típicamente, el de Ads); si hay
+// varios gana el menor por canal y campaña, para no depender del orden del map.
 func (s *MemoryStore) findAggByUTM(date time.Time, utmC, utmS, utmM string) *models.DailyAgg {
+	var best *models.DailyAgg
 	for k, v := range s.agg {
 		if k.Date.Equal(day(date)) && k.UTMCampaign == utmC && k.UTMSource == utmS && k.UTMMedium == utmM {
-			if k.Channel != "" || k.CampaignID != "" {
-				return v
+			if k.Channel == "" && k.CampaignID == "" {
+				continue
+			}
+			if best == nil || k.Channel < best.Key.Channel || (k.Channel == best.Key.Channel && k.CampaignID < best.Key.CampaignID) {
+				best = v
 			}
 		}
 	}
+	if best != nil {
+		return best
+	}
 	// si no hubo con channel, regresa cualquiera que coincida por UTM (puede ser la clave “vacía”)
 	for k, v := range s.agg {
 		if k.Date.Equal(day(date)) && k.UTMCampaign == utmC && k.UTMSource == utmS && k.UTMMedium == utmM {
@@ -74,7 +127,33 @@ func (s *MemoryStore) findAggByUTM(date time.Time, utmC, utmS, utmM string) *mod
 func (s *MemoryStore) UpsertCRM(o models.Opportunity) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.upsertCRM(o)
+}
+
+// CRMRecord es una oportunidad con su clave de idempotencia.
+type CRMRecord struct {
+	Key string
+	Opp models.Opportunity
+}
+
+// IngestCRMBatch aplica, con un solo lock y en orden, lo mismo que
+// TrackOpportunity + MarkSeen + UpsertCRM por registro: el lifecycle se
+// actualiza siempre y el agregado diario solo la primera vez. Devuelve qué
+// registros eran nuevos.
+func (s *MemoryStore) IngestCRMBatch(recs []CRMRecord, observedAt time.Time) []bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]bool, len(recs))
+	for i, r := range recs {
+		s.trackOpportunity(r.Key, r.Opp, observedAt)
+		if out[i] = s.markSeen(r.Key); out[i] {
+			s.upsertCRM(r.Opp)
+		}
+	}
+	return out
+}
 
+func (s *MemoryStore) upsertCRM(o models.Opportunity) {
 	// 1) intenta cruzar con un agregado existente (día + UTM)
 	agg := s.findAggByUTM(o.CreatedAt, o.UTMCampaign, o.UTMSource, o.UTMMedium)
 	if agg == nil {
@@ -96,6 +175,7 @@ func (s *MemoryStore) UpsertCRM(o models.Opportunity) {
 	}
 
 	// 3) funnel (acumulado recomendado)
+	s.touch(agg.Key.Date)
 	agg.Leads += 1
 
 	stage := strings.ToLower(strings.TrimSpace(o.Stage))
@@ -111,6 +191,116 @@ func (s *MemoryStore) UpsertCRM(o models.Opportunity) {
 	}
 }
 
+// TrackOpportunity registra el estado actual de una oportunidad (sin pasar
+// por MarkSeen: cada ingesta puede traer un cambio de etapa). La hora de cada
+// etapa sale del CRM (stage_history, stage_changed_at, closed_at, updated_at)
+// o, si no viene, de observedAt: "observed" cuando vimos la transición entre
+// ingestas y "first_seen" cuando ya estaba en esa etapa al conocerla.
+func (s *MemoryStore) TrackOpportunity(key string, o models.Opportunity, observedAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trackOpportunity(key, o, observedAt)
+}
+
+func (s *MemoryStore) trackOpportunity(key string, o models.Opportunity, observedAt time.Time) {
+	l, isNew := s.opps[key], false
+	if l == nil {
+		isNew = true
+		l = &models.OpportunityLifecycle{
+			Key:         key,
+			CreatedAt:   o.CreatedAt,
+			StageAt:     map[string]time.Time{"lead": o.CreatedAt},
+			StageSource: map[string]string{"lead": "crm"},
+			FirstSeen:   observedAt,
+		}
+		s.opps[key] = l
+	}
+	stage := strings.ToLower(strings.TrimSpace(o.Stage))
+	l.Stage = stage
+	l.Amount = o.Amount
+	l.UTMCampaign = o.UTMCampaign
+	l.UTMSource = o.UTMSource
+	l.UTMMedium = o.UTMMedium
+	l.LastSeen = observedAt
+	// canal/campaña por el mismo cruce día + UTM que usa UpsertCRM
+	if l.Channel == "" && l.CampaignID == "" {
+		if agg := s.findAggByUTM(o.CreatedAt, o.UTMCampaign, o.UTMSource, o.UTMMedium); agg != nil {
+			l.Channel = agg.Key.Channel
+			l.CampaignID = agg.Key.CampaignID
+		}
+	}
+
+	// los timestamps del CRM siempre ganan sobre los observados
+	for st, at := range o.StageHistory {
+		st = strings.ToLower(strings.TrimSpace(st))
+		if st != "" && !at.IsZero() {
+			l.StageAt[st] = at
+			l.StageSource[st] = "crm"
+		}
+	}
+	if stage == "" {
+		return
+	}
+	if at := crmStageTime(o, stage); !at.IsZero() {
+		if l.StageSource[stage] != "crm" {
+			l.StageAt[stage] = at
+			l.StageSource[stage] = "crm"
+		}
+		return
+	}
+	if _, ok := l.StageAt[stage]; ok {
+		return
+	}
+	l.StageAt[stage] = observedAt
+	l.StageSource[stage] = "observed"
+	if isNew {
+		l.StageSource[stage] = "first_seen"
+	}
+}
+
+func crmStageTime(o models.Opportunity, stage string) time.Time {
+	switch {
+	case !o.StageChangedAt.IsZero():
+		return o.StageChangedAt
+	case (stage == "closed_won" || stage == "closed_lost") && !o.ClosedAt.IsZero():
+		return o.ClosedAt
+	}
+	return o.UpdatedAt
+}
+
+// Opportunities devuelve copias de los lifecycles creados en [from, to].
+func (s *MemoryStore) Opportunities(from, to time.Time, f func(models.OpportunityLifecycle) bool) []models.OpportunityLifecycle {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []models.OpportunityLifecycle
+	for _, l := range s.opps {
+		d := day(l.CreatedAt)
+		if d.Before(from) || d.After(to) {
+			continue
+		}
+		c := *l
+		c.StageAt = make(map[string]time.Time, len(l.StageAt))
+		for k, v := range l.StageAt {
+			c.StageAt[k] = v
+		}
+		c.StageSource = make(map[string]string, len(l.StageSource))
+		for k, v := range l.StageSource {
+			c.StageSource[k] = v
+		}
+		if f == nil || f(c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Counts devuelve tamaños del store para métricas.
+func (s *MemoryStore) Counts() (aggs, opps, seen int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.agg), len(s.opps), len(s.seen)
+}
+
 func (s *MemoryStore) All() []models.DailyAgg {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// Revisiones por día: cada upsert sobre un DailyAgg sube la revisión de su
+// día. Un día exportado completo guarda la revisión que se envió; si luego
+// cambia, aparece en ChangedDays. La revisión es la versión del payload.
+
+// touch sube la revisión del día; se llama con s.mu tomado.
+func (s *MemoryStore) touch(d time.Time) {
+	s.rev[day(d).Format("2006-01-02")]++
+}
+
+// DayRevisions devuelve la revisión actual de cada día con datos en [from, to].
+func (s *MemoryStore) DayRevisions(from, to time.Time) map[string]int {
+	f, t := day(from).Format("2006-01-02"), day(to).Format("2006-01-02")
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := map[string]int{}
+	for d, r := range s.rev {
+		if d >= f && d <= t {
+			out[d] = r
+		}
+	}
+	return out
+}
+
+// MarkExported registra que el día se entregó completo en la revisión rev.
+func (s *MemoryStore) MarkExported(d string, rev int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rev > s.exported[d] {
+		s.exported[d] = rev
+	}
+}
+
+// ChangedDays lista (ordenados) los días ya exportados que cambiaron desde
+// su última exportación exitosa.
+func (s *MemoryStore) ChangedDays() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []string
+	for d, r := range s.exported {
+		if s.rev[d] > r {
+			out = append(out, d)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
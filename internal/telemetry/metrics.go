@@ -0,0 +1,32 @@
+package telemetry
+
+// Métricas del servicio (todas en Default).
+var (
+	IngestRequests = NewCounterVec("ingest_requests_total",
+		"Upstream fetch attempts by source and HTTP status (\"error\" = transport error, \"circuit_open\" = failed fast).", "source", "code")
+	IngestRetries = NewCounterVec("ingest_retries_total",
+		"Upstream fetch retries by source.", "source")
+	IngestFailures = NewCounterVec("ingest_failures_total",
+		"Upstream fetches that failed after all retries.", "source")
+	IngestLatency = NewHistogramVec("ingest_latency_seconds",
+		"Upstream fetch attempt latency by source.", DefBuckets, "source")
+	IngestRecords = NewCounterVec("ingest_records_total",
+		"Records read by source and result (accepted | rejected | duplicate | filtered).", "source", "result")
+
+	ExportAttempts = NewCounterVec("export_attempts_total",
+		"Export deliveries by sink and outcome (delivered | failed | unchanged | dead | breaker_open).", "sink", "outcome")
+	ExportRows = NewCounterVec("export_rows_total",
+		"Rows delivered by sink.", "sink")
+	ExportLatency = NewHistogramVec("export_latency_seconds",
+		"Export delivery attempt latency by sink.", DefBuckets, "sink")
+
+	BreakerTransitions = NewCounterVec("circuit_breaker_transitions_total",
+		"Circuit breaker state changes by endpoint and new state.", "endpoint", "state")
+	BreakerRejections = NewCounterVec("circuit_breaker_rejections_total",
+		"Requests failed fast because the endpoint's circuit was open.", "endpoint")
+
+	HTTPRequests = NewCounterVec("http_requests_total",
+		"API requests by route, method and status.", "route", "method", "code")
+	HTTPLatency = NewHistogramVec("http_request_duration_seconds",
+		"API request latency by route, method and status.", DefBuckets, "route", "method", "code")
+)
@@ -0,0 +1,66 @@
+// Package telemetry tiene la instrumentación del servicio: métricas de
+// Prometheus (client_golang) y trazas de OpenTelemetry.
+package telemetry
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefBuckets son los buckets de latencia por defecto (segundos).
+var DefBuckets = prometheus.DefBuckets
+
+// Default es el registro que sirve Handler: las métricas de este paquete más
+// las del runtime de Go y del proceso.
+var Default = prometheus.NewRegistry()
+
+func init() {
+	Default.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+// Handler sirve Default en el formato de exposición de Prometheus.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Default, promhttp.HandlerOpts{})
+}
+
+// NewCounterVec registra un contador con labels en Default.
+func NewCounterVec(name, help string, labels ...string) *prometheus.CounterVec {
+	c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	Default.MustRegister(c)
+	return c
+}
+
+// NewHistogramVec registra un histograma con labels en Default.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	h := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)
+	Default.MustRegister(h)
+	return h
+}
+
+// GaugeFunc registra un gauge que se calcula al servir /metrics.
+func GaugeFunc(name, help string, fn func() float64) {
+	Default.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, fn))
+}
+
+// GaugeVecFunc registra un gauge con un label cuyas series se calculan al
+// servir /metrics (valor del label → valor).
+func GaugeVecFunc(name, help, label string, fn func() map[string]float64) {
+	Default.MustRegister(&gaugeVecFunc{desc: prometheus.NewDesc(name, help, []string{label}, nil), fn: fn})
+}
+
+// gaugeVecFunc es un Collector: las series salen de fn en cada scrape.
+type gaugeVecFunc struct {
+	desc *prometheus.Desc
+	fn   func() map[string]float64
+}
+
+func (g *gaugeVecFunc) Describe(ch chan<- *prometheus.Desc) { ch <- g.desc }
+
+func (g *gaugeVecFunc) Collect(ch chan<- prometheus.Metric) {
+	for v, f := range g.fn() {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, f, v)
+	}
+}
@@ -0,0 +1,115 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trazas con el SDK de OpenTelemetry: IDs W3C, propagación por traceparent y
+// spans exportados en lote a un archivo NDJSON o a un endpoint OTLP/HTTP.
+
+const scope = "github.com/AngelCh415/ELT_GO"
+
+const (
+	KindInternal = trace.SpanKindInternal
+	KindServer   = trace.SpanKindServer
+	KindClient   = trace.SpanKindClient
+)
+
+func init() { otel.SetTextMapPropagator(propagation.TraceContext{}) }
+
+// StartSpan abre un span hijo del que haya en ctx (o del traceparent remoto
+// extraído); si no hay ninguno empieza una traza nueva.
+func StartSpan(ctx context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	return otel.Tracer(scope).Start(ctx, name, trace.WithSpanKind(kind))
+}
+
+// Error registra err en el span y lo marca como fallido (nil no hace nada).
+func Error(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Extract lee traceparent de h y lo deja en ctx como padre remoto.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// NewTracer instala el TracerProvider global con el nombre del servicio. Con
+// exp nil los spans tienen IDs y se propagan pero no se exportan; si no,
+// salen en lotes cada flushEvery (<= 0: el default del SDK, 5s).
+func NewTracer(service string, exp sdktrace.SpanExporter, flushEvery time.Duration) *sdktrace.TracerProvider {
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	}
+	if exp != nil {
+		var bopts []sdktrace.BatchSpanProcessorOption
+		if flushEvery > 0 {
+			bopts = append(bopts, sdktrace.WithBatchTimeout(flushEvery))
+		}
+		opts = append(opts, sdktrace.WithBatcher(exp, bopts...))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	return tp
+}
+
+// NewFileExporter agrega los spans a path como NDJSON (un span por línea).
+func NewFileExporter(path string) (sdktrace.SpanExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return fileExporter{exp, f}, nil
+}
+
+// fileExporter cierra el archivo al apagar el exporter.
+type fileExporter struct {
+	sdktrace.SpanExporter
+	f *os.File
+}
+
+func (e fileExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if cerr := e.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// NewOTLPExporter hace POST a <endpoint>/v1/traces en OTLP/HTTP (protobuf).
+func NewOTLPExporter(endpoint string, timeout time.Duration) (sdktrace.SpanExporter, error) {
+	return otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(strings.TrimRight(endpoint, "/")+"/v1/traces"),
+		otlptracehttp.WithTimeout(timeout))
+}
+
+// Transport abre un span client "HTTP <METHOD>" por request saliente y
+// propaga traceparent.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return "HTTP " + r.Method
+	}))
+}
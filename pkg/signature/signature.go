@@ -0,0 +1,191 @@
+// Package signature firma y verifica los webhooks del ETL (export y alertas).
+//
+// Cada request lleva:
+//
+//	X-Signature-Timestamp: segundos unix del envío
+//	X-Key-Id:              ids de las claves usadas, separados por coma
+//	X-Signature:           HMAC-SHA256 (hex) de "<timestamp>.<body>" por cada
+//	                       clave, en el mismo orden que X-Key-Id
+//	X-Signed-Headers:      (opcional) headers que también cubre la firma,
+//	                       separados por coma; entonces se firma
+//	                       "<timestamp>.<nombre>:<valor>\n...<body>" con los
+//	                       nombres en minúscula y en el orden listado
+//
+// Durante una rotación el emisor firma con la clave nueva y la anterior; el
+// receptor acepta cualquier clave que conozca. El timestamp firmado permite
+// rechazar repeticiones fuera de la tolerancia.
+//
+// Los receptores en Go pueden usar VerifyRequest directamente.
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderSignature = "X-Signature"
+	HeaderTimestamp = "X-Signature-Timestamp"
+	HeaderKeyID     = "X-Key-Id"
+	HeaderSigned    = "X-Signed-Headers"
+
+	// DefaultTolerance es la antigüedad máxima aceptada de un request.
+	DefaultTolerance = 5 * time.Minute
+)
+
+var (
+	ErrMissingHeaders = errors.New("signature: missing signature headers")
+	ErrBadTimestamp   = errors.New("signature: bad timestamp")
+	ErrExpired        = errors.New("signature: timestamp outside tolerance")
+	ErrUnknownKey     = errors.New("signature: no known key id")
+	ErrMismatch       = errors.New("signature: mismatch")
+)
+
+// Key es un secreto activo identificado por ID.
+type Key struct {
+	ID     string
+	Secret string
+}
+
+// ParseKeys lee entradas "id:secret" (p. ej. de una variable separada por comas).
+func ParseKeys(entries []string) ([]Key, error) {
+	out := make([]Key, 0, len(entries))
+	for _, e := range entries {
+		id, secret, ok := strings.Cut(e, ":")
+		if !ok || id == "" || secret == "" {
+			return nil, fmt.Errorf("signature: bad key %q (want id:secret)", id)
+		}
+		out = append(out, Key{ID: id, Secret: secret})
+	}
+	return out, nil
+}
+
+// Sign devuelve el HMAC-SHA256 (hex) de "<ts>.<body>".
+func Sign(secret string, ts int64, body []byte) string {
+	return sign(secret, ts, "", body)
+}
+
+// sign firma "<ts>.<headers><body>"; headers es la forma canónica de los
+// headers firmados (vacía si no hay).
+func sign(secret string, ts int64, headers string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write([]byte(headers))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonical arma "<nombre>:<valor>\n" por cada header de X-Signed-Headers.
+func canonical(h http.Header) string {
+	var sb strings.Builder
+	for _, name := range signedNames(h) {
+		sb.WriteString(name + ":" + h.Get(name) + "\n")
+	}
+	return sb.String()
+}
+
+func signedNames(h http.Header) []string {
+	v := h.Get(HeaderSigned)
+	if v == "" {
+		return nil
+	}
+	names := strings.Split(v, ",")
+	for i := range names {
+		names[i] = strings.ToLower(strings.TrimSpace(names[i]))
+	}
+	return names
+}
+
+// Covers dice si la firma cubre el header name. Un receptor que confía en un
+// header (p. ej. versiones) debe exigirlo: los no firmados se pueden alterar.
+func Covers(h http.Header, name string) bool {
+	for _, n := range signedNames(h) {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetHeaders firma body (y los headers signed, que ya deben estar en h) con
+// todas las claves y deja los headers de firma en h.
+func SetHeaders(h http.Header, keys []Key, now time.Time, body []byte, signed ...string) {
+	h.Del(HeaderSigned)
+	if len(signed) > 0 {
+		h.Set(HeaderSigned, strings.ToLower(strings.Join(signed, ",")))
+	}
+	headers := canonical(h)
+	ts := now.Unix()
+	ids := make([]string, len(keys))
+	sigs := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = k.ID
+		sigs[i] = sign(k.Secret, ts, headers, body)
+	}
+	h.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	h.Set(HeaderKeyID, strings.Join(ids, ","))
+	h.Set(HeaderSignature, strings.Join(sigs, ","))
+}
+
+// Verify comprueba la firma de body y de los headers de X-Signed-Headers.
+// keys son los secretos que el receptor acepta (id → secret); tolerance <= 0
+// usa DefaultTolerance.
+func Verify(h http.Header, body []byte, keys map[string]string, tolerance time.Duration, now time.Time) error {
+	tsH, idH, sigH := h.Get(HeaderTimestamp), h.Get(HeaderKeyID), h.Get(HeaderSignature)
+	if tsH == "" || idH == "" || sigH == "" {
+		return ErrMissingHeaders
+	}
+	ts, err := strconv.ParseInt(tsH, 10, 64)
+	if err != nil {
+		return ErrBadTimestamp
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return ErrExpired
+	}
+
+	ids, sigs := strings.Split(idH, ","), strings.Split(sigH, ",")
+	if len(ids) != len(sigs) {
+		return ErrMissingHeaders
+	}
+	headers := canonical(h)
+	known := false
+	for i, id := range ids {
+		secret, ok := keys[strings.TrimSpace(id)]
+		if !ok {
+			continue
+		}
+		known = true
+		want := sign(secret, ts, headers, body)
+		if hmac.Equal([]byte(want), []byte(strings.TrimSpace(sigs[i]))) {
+			return nil
+		}
+	}
+	if !known {
+		return ErrUnknownKey
+	}
+	return ErrMismatch
+}
+
+// VerifyRequest lee el body de r, lo verifica y lo deja disponible de nuevo
+// en r.Body. Devuelve el body leído.
+func VerifyRequest(r *http.Request, keys map[string]string, tolerance time.Duration) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, Verify(r.Header, body, keys, tolerance, time.Now())
+}
@@ -0,0 +1,113 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/httpx"
+)
+
+func accessLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var out []map[string]any
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if l == "" {
+			continue
+		}
+		var m map[string]any
+		if err := json.Unmarshal([]byte(l), &m); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestAccessLogStatusBytesAndPanic(t *testing.T) {
+	var buf bytes.Buffer
+	proxies, err := httpx.ParseProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw := httpx.AccessLogger(slog.New(slog.NewJSONHandler(&buf, nil)), httpx.AccessLog{TrustedProxies: proxies})
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/boom":
+			panic("kaput")
+		case "/bad":
+			http.Error(w, "upstream", http.StatusBadGateway)
+		default:
+			w.Write([]byte("hello"))
+		}
+	}))
+
+	req := httptest.NewRequest("GET", "/ok", nil)
+	req.RemoteAddr = "10.1.2.3:5555"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.9.9.9")
+	req.Header.Set("User-Agent", "probe/1.0")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	// sin proxy de confianza se ignora X-Forwarded-For
+	req = httptest.NewRequest("GET", "/bad", nil)
+	req.RemoteAddr = "198.51.100.7:1234"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/boom", nil))
+	if rr.Code != 500 {
+		t.Fatalf("panic answered %d", rr.Code)
+	}
+
+	lines := accessLines(t, &buf)
+	if len(lines) != 3 {
+		t.Fatalf("lines: %v", lines)
+	}
+	ok, bad, boom := lines[0], lines[1], lines[2]
+	if ok["status"] != 200.0 || ok["bytes"] != 5.0 || ok["client_ip"] != "203.0.113.9" || ok["user_agent"] != "probe/1.0" || ok["class"] != "ok" {
+		t.Fatalf("ok line: %v", ok)
+	}
+	if bad["status"] != 502.0 || bad["class"] != "server_error" || bad["level"] != "ERROR" || bad["client_ip"] != "198.51.100.7" {
+		t.Fatalf("bad line: %v", bad)
+	}
+	if boom["status"] != 500.0 || boom["class"] != "panic" || boom["panic"] != "kaput" {
+		t.Fatalf("panic line: %v", boom)
+	}
+}
+
+func TestAccessLogSamplesOnlySuccess(t *testing.T) {
+	t.Setenv("ACCESS_LOG_SAMPLE", "0")
+	cfg := config.FromEnv()
+	if cfg.AccessLogSample != 0 {
+		t.Fatalf("sample %v", cfg.AccessLogSample)
+	}
+	var buf bytes.Buffer
+	mw := httpx.AccessLogger(slog.New(slog.NewJSONHandler(&buf, nil)), httpx.AccessLog{Sample: &cfg.AccessLogSample})
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	for i := 0; i < 50; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ok", nil))
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	lines := accessLines(t, &buf)
+	if len(lines) != 1 || lines[0]["status"] != 404.0 || lines[0]["class"] != "client_error" {
+		t.Fatalf("want only the 404, got %v", lines)
+	}
+
+	// sin la variable se loguea todo
+	os.Unsetenv("ACCESS_LOG_SAMPLE")
+	if s := config.FromEnv().AccessLogSample; s != 1 {
+		t.Fatalf("default sample %v", s)
+	}
+}
@@ -0,0 +1,197 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/alerts"
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/metrics"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+	"github.com/AngelCh415/ELT_GO/pkg/signature"
+)
+
+func TestAlertFiresOnceAndIsSigned(t *testing.T) {
+	var mu sync.Mutex
+	var got []models.AlertEvent
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := signature.VerifyRequest(r, map[string]string{"k1": "s3cret"}, time.Minute)
+		if err != nil {
+			t.Errorf("bad signature: %v", err)
+		}
+		var ev models.AlertEvent
+		json.Unmarshal(b, &ev)
+		mu.Lock()
+		got = append(got, ev)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	st := store.NewMemoryStore()
+	now, _ := time.Parse("2006-01-02", "2025-08-08")
+	// CPA de ayer = 100 / 1 lead
+	st.UpsertAds(models.AdsPerformance{Date: now.AddDate(0, 0, -1), Channel: "google_ads", CampaignID: "C-1",
+		Clicks: 10, Cost: 100, UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+	st.UpsertCRM(models.Opportunity{CreatedAt: now.AddDate(0, 0, -1), Stage: "lead",
+		UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+
+	cfg := config.Config{AlertWebhookURL: hook.URL, AlertWebhookSecret: "s3cret", AlertWebhookKeyID: "k1", AlertDedupeWindow: time.Hour, AlertCooldown: time.Hour}
+	mSvc := metrics.NewService(st, cfg)
+	svc := alerts.NewService(ingest.NewHTTPClient(2*time.Second), mSvc, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	rule, err := svc.Create(models.AlertRule{Metric: "cpa", Channel: "google_ads", WindowDays: 7, Op: ">", Threshold: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svc.Evaluate(context.Background(), now)
+	svc.Evaluate(context.Background(), now.Add(time.Minute)) // dedupe
+	svc.Drain(context.Background())
+	if len(got) != 1 || got[0].Status != "firing" || got[0].Value != 100 {
+		t.Fatalf("expected one firing event, got %+v", got)
+	}
+
+	// más leads bajan el CPA a 33.33 y la alerta se resuelve
+	for i := 0; i < 2; i++ {
+		st.UpsertCRM(models.Opportunity{CreatedAt: now.AddDate(0, 0, -1), Stage: "lead",
+			UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+	}
+	svc.Evaluate(context.Background(), now.Add(2*time.Minute))
+	svc.Drain(context.Background())
+	if len(got) != 2 || got[1].Status != "resolved" || got[1].RuleID != rule.ID {
+		t.Fatalf("expected resolved event, got %+v", got)
+	}
+	if len(svc.Active()) != 0 {
+		t.Fatal("expected no active alerts")
+	}
+
+	if _, err := svc.Create(models.AlertRule{Metric: "nope", Op: ">"}); err == nil {
+		t.Fatal("expected validation error")
+	}
+}
+
+func TestAlertCooldownSuppressesFlapping(t *testing.T) {
+	var mu sync.Mutex
+	var got []models.AlertEvent
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev models.AlertEvent
+		json.NewDecoder(r.Body).Decode(&ev)
+		mu.Lock()
+		got = append(got, ev)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	st := store.NewMemoryStore()
+	now, _ := time.Parse("2006-01-02", "2025-08-08")
+	// el store acumula: más costo sube el CPA, más leads lo bajan
+	addCost := func(cost float64) {
+		st.UpsertAds(models.AdsPerformance{Date: now.AddDate(0, 0, -1), Channel: "google_ads", CampaignID: "C-1",
+			Clicks: 10, Cost: cost, UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+	}
+	addLeads := func(n int) {
+		for i := 0; i < n; i++ {
+			st.UpsertCRM(models.Opportunity{CreatedAt: now.AddDate(0, 0, -1), Stage: "lead",
+				UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+		}
+	}
+	cfg := config.Config{AlertWebhookURL: hook.URL, AlertWebhookSecret: "s3cret", AlertDedupeWindow: time.Hour, AlertCooldown: time.Hour}
+	svc := alerts.NewService(ingest.NewHTTPClient(2*time.Second), metrics.NewService(st, cfg), slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	if _, err := svc.Create(models.AlertRule{Metric: "cpa", Channel: "google_ads", WindowDays: 7, Op: ">", Threshold: 50, CooldownMinutes: 120}); err != nil {
+		t.Fatal(err)
+	}
+	eval := func(at time.Duration) int {
+		svc.Evaluate(context.Background(), now.Add(at))
+		svc.Drain(context.Background())
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got)
+	}
+
+	addCost(100)
+	addLeads(1) // CPA 100
+	if n := eval(0); n != 1 {
+		t.Fatalf("firing: %+v", got)
+	}
+	addLeads(2) // CPA 33
+	if n := eval(61 * time.Minute); n != 2 || got[1].Status != "resolved" {
+		t.Fatalf("resolved: %+v", got)
+	}
+	// vuelve a dispararse dentro del cooldown: no se avisa ni al re-disparar ni
+	// en las evaluaciones siguientes, aunque el último envío supere el dedupe
+	addCost(200) // CPA 100
+	for _, at := range []time.Duration{62 * time.Minute, 63 * time.Minute, 2 * time.Hour} {
+		if n := eval(at); n != 2 {
+			t.Fatalf("sent during cooldown at +%s: %+v", at, got)
+		}
+	}
+	if len(svc.Active()) != 1 {
+		t.Fatal("suppressed alert should still be active")
+	}
+	// vencido el cooldown y todavía disparada, se avisa una vez
+	if n := eval(3*time.Hour + 2*time.Minute); n != 3 || got[2].Status != "firing" {
+		t.Fatalf("after cooldown: %+v", got)
+	}
+	if n := eval(3*time.Hour + 3*time.Minute); n != 3 {
+		t.Fatalf("dedupe after cooldown: %+v", got)
+	}
+}
+
+func TestAlertWebhookDoesNotBlockEvaluate(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+	}))
+	defer hook.Close()
+	defer close(release)
+
+	st := store.NewMemoryStore()
+	now, _ := time.Parse("2006-01-02", "2025-08-08")
+	st.UpsertAds(models.AdsPerformance{Date: now.AddDate(0, 0, -1), Channel: "google_ads", CampaignID: "C-1",
+		Clicks: 10, Cost: 100, UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rule := models.AlertRule{Metric: "cost", Channel: "google_ads", WindowDays: 7, Op: ">", Threshold: 50}
+
+	cfg := config.Config{AlertWebhookURL: hook.URL, AlertWebhookSecret: "s3cret", AlertTimeout: 100 * time.Millisecond,
+		AnomalyMethod: "mad", ExportDispatchInterval: time.Second}
+	svc := alerts.NewService(ingest.NewHTTPClient(5*time.Second), metrics.NewService(st, cfg), log, cfg)
+	svc.Create(rule)
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	svc.Evaluate(context.Background(), now)
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Fatalf("Evaluate waited %s for the webhook", d)
+	}
+	// el envío se corta en AlertTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := svc.Drain(ctx); err != nil || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("drain: %v, calls=%d", err, calls)
+	}
+
+	// sin secreto no se envía nada
+	cfg.AlertWebhookSecret = ""
+	svc = alerts.NewService(ingest.NewHTTPClient(5*time.Second), metrics.NewService(st, cfg), log, cfg)
+	svc.Create(rule)
+	svc.Evaluate(context.Background(), now)
+	svc.Drain(context.Background())
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("webhook sent without a secret: %d calls", n)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("config without webhook secret accepted")
+	}
+}
@@ -0,0 +1,65 @@
+package test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/metrics"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+)
+
+func TestAnomalyDetectsClickDrop(t *testing.T) {
+	st := store.NewMemoryStore()
+	d0, _ := time.Parse("2006-01-02", "2025-08-01")
+
+	// 10 días estables y luego una caída fuerte de clicks
+	clicks := []int{100, 104, 98, 101, 97, 103, 99, 102, 100, 96, 10}
+	for i, c := range clicks {
+		st.UpsertAds(models.AdsPerformance{
+			Date:        d0.AddDate(0, 0, i),
+			Channel:     "google_ads",
+			CampaignID:  "C-1001",
+			Clicks:      c,
+			Impressions: 1000,
+			Cost:        50,
+			UTMCampaign: "camp",
+			UTMSource:   "src",
+			UTMMedium:   "med",
+		})
+	}
+
+	cfg := config.Config{AnomalyMethod: "mad", AnomalyWindow: 7, AnomalySensitivity: 3}
+	svc := metrics.NewService(st, cfg)
+	if n := svc.DetectAnomalies(); n == 0 {
+		t.Fatal("expected anomalies")
+	}
+
+	rows, err := svc.QueryAnomalies(url.Values{"metric": {"clicks"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 clicks anomaly, got %d: %+v", len(rows), rows)
+	}
+	a := rows[0]
+	if a.Date != "2025-08-11" || a.Direction != "drop" || a.Observed != 10 {
+		t.Fatalf("unexpected anomaly: %+v", a)
+	}
+	if a.Observed >= a.Lower {
+		t.Fatalf("observed should be below lower bound: %+v", a)
+	}
+}
+
+func TestAnomalyMethodValidated(t *testing.T) {
+	t.Setenv("ANOMALY_METHOD", "zscore")
+	if err := config.FromEnv().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ANOMALY_METHOD", "median")
+	if err := config.FromEnv().Validate(); err == nil {
+		t.Fatal("unknown ANOMALY_METHOD accepted")
+	}
+}
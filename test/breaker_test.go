@@ -0,0 +1,147 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/breaker"
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/health"
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+	"github.com/AngelCh415/ELT_GO/internal/telemetry"
+)
+
+func TestCircuitBreakerFailsFastAndRecovers(t *testing.T) {
+	var down atomic.Bool
+	var crmCalls int32
+	down.Store(true)
+	ads := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`[]`)) }))
+	crm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&crmCalls, 1)
+		if down.Load() {
+			http.Error(w, "down", 503)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer ads.Close()
+	defer crm.Close()
+
+	cfg := config.Config{AdsURL: ads.URL, CrmURL: crm.URL, Retry: map[string]config.RetryConfig{
+		"crm": {MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond},
+	}}
+	bcl := breaker.NewClient(ingest.NewHTTPClient(2 * time.Second))
+	bcl.Register("ads", ads.URL, 2, 200*time.Millisecond)
+	bcl.Register("crm", crm.URL, 2, 200*time.Millisecond)
+	etl := ingest.NewETL(bcl, store.NewMemoryStore(), slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	check := health.Breakers(bcl)
+
+	// dos 503 abren el circuito: el tercer intento ya no llega al CRM
+	var open *breaker.OpenError
+	if err := etl.Run(context.Background(), nil); !errors.As(err, &open) || open.Endpoint != "crm" {
+		t.Fatalf("first run: %v", err)
+	}
+	if n := atomic.LoadInt32(&crmCalls); n != 2 {
+		t.Fatalf("crm calls = %d, want 2", n)
+	}
+	start := time.Now()
+	if err := etl.Run(context.Background(), nil); !errors.As(err, &open) || time.Since(start) > 50*time.Millisecond {
+		t.Fatalf("second run should fail fast: %v after %s", err, time.Since(start))
+	}
+	if n := atomic.LoadInt32(&crmCalls); n != 2 {
+		t.Fatalf("crm hit while open: %d calls", n)
+	}
+	if _, err := check(context.Background()); err == nil || !strings.Contains(err.Error(), "crm open") {
+		t.Fatalf("breaker check: %v", err)
+	}
+
+	// tras el cooldown pasa un request de prueba; si anda, se cierra
+	down.Store(false)
+	time.Sleep(250 * time.Millisecond)
+	if err := etl.Run(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := check(context.Background()); err != nil || msg != "ads=closed,crm=closed" {
+		t.Fatalf("after recovery: %q %v", msg, err)
+	}
+
+	rec := httptest.NewRecorder()
+	telemetry.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`circuit_breaker_rejections_total{endpoint="crm"}`,
+		`circuit_breaker_transitions_total{endpoint="crm",state="open"}`,
+		`circuit_breaker_transitions_total{endpoint="crm",state="closed"}`,
+		`ingest_requests_total{code="circuit_open",source="crm"}`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("missing %s", want)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenFailureReopens(t *testing.T) {
+	b := breaker.NewClient(http.DefaultClient)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { http.Error(w, "x", 500) }))
+	defer srv.Close()
+	b.Register("sink", srv.URL, 1, 50*time.Millisecond)
+
+	get := func() error {
+		req, _ := http.NewRequest("GET", srv.URL+"/hook", nil)
+		resp, err := b.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	get() // 500: abre
+	if st := b.Breakers()[0].State(); st != breaker.Open {
+		t.Fatalf("state = %s", st)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if st := b.Breakers()[0].State(); st != breaker.HalfOpen {
+		t.Fatalf("state after cooldown = %s", st)
+	}
+	get() // la prueba falla: vuelve a abrir
+	var open *breaker.OpenError
+	if err := get(); !errors.As(err, &open) {
+		t.Fatalf("want fail fast after failed probe, got %v", err)
+	}
+}
+
+func TestLedgerDoesNotCountBreakerRejections(t *testing.T) {
+	var calls int32
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "down", 503)
+	}))
+	defer sink.Close()
+	bcl := breaker.NewClient(ingest.NewHTTPClient(2 * time.Second))
+	bcl.Register("sink", sink.URL, 1, time.Minute)
+	st := store.NewMemoryStore()
+	d0, _ := time.Parse("2006-01-02", "2025-08-01")
+	st.UpsertAds(models.AdsPerformance{Date: d0, Channel: "google_ads", CampaignID: "C-1", Clicks: 3,
+		UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+	cfg := config.Config{SinkURL: sink.URL, SinkSecret: "s", ExportMaxAttempts: 2}
+	etl := ingest.NewETL(bcl, st, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	ctx := context.Background()
+
+	etl.ExportDay(ctx, d0) // 503: abre el circuito
+	etl.DispatchDue(ctx)   // rechazado por el breaker: no gasta el segundo intento
+	h := etl.ExportHistory(nil)
+	if len(h) != 1 || h[0].Status != "retrying" || h[0].Attempts != 1 || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("breaker rejection counted as an attempt: %+v calls=%d", h, calls)
+	}
+	if time.Until(h[0].NextAttemptAt) < 50*time.Second {
+		t.Fatalf("next attempt %s should wait for the breaker", h[0].NextAttemptAt)
+	}
+}
@@ -0,0 +1,49 @@
+package test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/budget"
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+)
+
+func TestBudgetPacingFlagsOverDelivery(t *testing.T) {
+	st := store.NewMemoryStore()
+	d0, _ := time.Parse("2006-01-02", "2025-08-01")
+	// 10 días gastando 50/día en un mes de 31 días con presupuesto 1000
+	for i := 0; i < 10; i++ {
+		st.UpsertAds(models.AdsPerformance{
+			Date: d0.AddDate(0, 0, i), Channel: "google_ads", CampaignID: "C-1001",
+			Cost: 50, UTMCampaign: "camp", UTMSource: "src", UTMMedium: "med",
+		})
+	}
+
+	svc := budget.NewService(st, config.Config{BudgetPacingThreshold: 0.1})
+	b, err := svc.Create(models.Budget{CampaignID: "C-1001", Amount: 1000, Period: "monthly", Month: "2025-08"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Start != "2025-08-01" || b.End != "2025-08-31" {
+		t.Fatalf("unexpected period: %+v", b)
+	}
+
+	rows, err := svc.Pacing(url.Values{"as_of": {"2025-08-10"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rows))
+	}
+	p := rows[0]
+	if p.SpentToDate != 500 || p.ProjectedSpend != 1550 || p.Status != "over" {
+		t.Fatalf("unexpected pacing: %+v", p)
+	}
+
+	if _, err := svc.Create(models.Budget{Amount: 10, Month: "2025-08"}); err == nil {
+		t.Fatal("expected error without campaign_id/channel")
+	}
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/metrics"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+)
+
+func TestCohortCumulativeConversion(t *testing.T) {
+	st := store.NewMemoryStore()
+	created, _ := time.Parse("2006-01-02", "2025-08-04") // lunes
+	seen := created.AddDate(0, 0, 1)
+
+	// 4 leads la misma semana; el primero cierra a los 20 días, el segundo a los 45
+	for i, id := range []string{"O-1", "O-2", "O-3", "O-4"} {
+		st.TrackOpportunity(id, models.Opportunity{OpportunityID: id, Stage: "lead", CreatedAt: created.AddDate(0, 0, i)}, seen)
+	}
+	st.TrackOpportunity("O-1", models.Opportunity{OpportunityID: "O-1", Stage: "closed_won", Amount: 100,
+		CreatedAt: created, ClosedAt: created.AddDate(0, 0, 20)}, created.AddDate(0, 0, 30))
+	// sin closed_at: se usa la hora observada
+	st.TrackOpportunity("O-2", models.Opportunity{OpportunityID: "O-2", Stage: "closed_won", Amount: 50,
+		CreatedAt: created.AddDate(0, 0, 1)}, created.AddDate(0, 0, 46))
+
+	svc := metrics.NewService(st, config.Config{})
+	rows, err := svc.Cohorts(url.Values{"as_of": {"2025-12-31"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Cohort != "2025-08-04" || rows[0].Leads != 4 {
+		t.Fatalf("unexpected cohorts: %+v", rows)
+	}
+	b := rows[0].Buckets
+	if b[0].ClosedWon != 1 || b[0].Revenue != 100 || b[0].Conversion != 0.25 {
+		t.Fatalf("30d bucket: %+v", b[0])
+	}
+	if b[1].ClosedWon != 2 || b[1].Revenue != 150 || !b[1].Complete {
+		t.Fatalf("60d bucket: %+v", b[1])
+	}
+}
+
+func TestCohortIgnoresFirstSeenWins(t *testing.T) {
+	st := store.NewMemoryStore()
+	created, _ := time.Parse("2006-01-02", "2025-08-04")
+
+	// ya ganada al conocerla y sin closed_at: la fecha de la ingesta no es la
+	// del cierre, no debe caer en ningún bucket
+	st.TrackOpportunity("O-1", models.Opportunity{OpportunityID: "O-1", Stage: "closed_won", Amount: 100,
+		CreatedAt: created}, created.AddDate(0, 0, 10))
+	st.TrackOpportunity("O-2", models.Opportunity{OpportunityID: "O-2", Stage: "lead", CreatedAt: created}, created)
+
+	svc := metrics.NewService(st, config.Config{})
+	rows, err := svc.Cohorts(url.Values{"as_of": {"2025-12-31"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Leads != 2 {
+		t.Fatalf("unexpected cohorts: %+v", rows)
+	}
+	for _, b := range rows[0].Buckets {
+		if b.ClosedWon != 0 || b.Revenue != 0 {
+			t.Fatalf("first_seen win counted in %dd bucket: %+v", b.Days, b)
+		}
+	}
+}
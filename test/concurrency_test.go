@@ -0,0 +1,124 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/mocksrc"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/retry"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+)
+
+func TestParallelIngestMatchesSequential(t *testing.T) {
+	start, _ := time.Parse("2006-01-02", "2025-08-01")
+	gen := mocksrc.DefaultGenConfig()
+	gen.Seed, gen.Start, gen.Days, gen.Noise, gen.BadRows, gen.MissingUTM = 11, start, 10, 0.3, 0.1, 0.1
+	data := mocksrc.Generate(gen)
+	// duplicados dentro de la misma respuesta: gana la primera ocurrencia
+	data.Ads = append(data.Ads, data.Ads[:5]...)
+	data.CRM = append(data.CRM, data.CRM[:5]...)
+	hs := httptest.NewServer(mocksrc.NewServer(data, mocksrc.Faults{}, 11).Handler())
+	defer hs.Close()
+
+	type snapshot struct {
+		aggs   []models.DailyAgg
+		opps   []models.OpportunityLifecycle
+		counts [3]int
+	}
+	ingestWith := func(workers, batch int) snapshot {
+		st := store.NewMemoryStore()
+		cfg := config.Config{AdsURL: hs.URL + "/ads", CrmURL: hs.URL + "/crm", IngestWorkers: workers, IngestBatchSize: batch}
+		etl := ingest.NewETL(ingest.NewHTTPClient(2*time.Second), st, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+		for i := 0; i < 2; i++ { // la segunda corrida es toda duplicados
+			if err := etl.Run(context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s := snapshot{aggs: st.All(), opps: st.Opportunities(time.Time{}, start.AddDate(1, 0, 0), nil)}
+		s.counts[0], s.counts[1], s.counts[2] = st.Counts()
+		sort.Slice(s.aggs, func(i, j int) bool { return aggLess(s.aggs[i].Key, s.aggs[j].Key) })
+		sort.Slice(s.opps, func(i, j int) bool { return s.opps[i].Key < s.opps[j].Key })
+		for i := range s.opps { // FirstSeen/LastSeen son la hora de la corrida
+			s.opps[i].FirstSeen, s.opps[i].LastSeen = time.Time{}, time.Time{}
+			for stage, src := range s.opps[i].StageSource {
+				if src != "crm" {
+					s.opps[i].StageAt[stage] = time.Time{}
+				}
+			}
+		}
+		return s
+	}
+
+	seq := ingestWith(1, 0)
+	if len(seq.aggs) == 0 || len(seq.opps) == 0 {
+		t.Fatalf("nothing ingested: %+v", seq.counts)
+	}
+	// (1, 0) de nuevo comprueba que el secuencial mismo es determinista
+	for _, c := range []struct{ workers, batch int }{{1, 0}, {4, 7}, {16, 1}, {3, 1000}} {
+		if got := ingestWith(c.workers, c.batch); !reflect.DeepEqual(got, seq) {
+			t.Fatalf("workers=%d batch=%d: result differs from sequential", c.workers, c.batch)
+		}
+	}
+}
+
+func aggLess(a, b models.DailyAggKey) bool {
+	if !a.Date.Equal(b.Date) {
+		return a.Date.Before(b.Date)
+	}
+	for _, p := range [][2]string{{a.Channel, b.Channel}, {a.CampaignID, b.CampaignID}, {a.UTMCampaign, b.UTMCampaign}, {a.UTMSource, b.UTMSource}} {
+		if p[0] != p[1] {
+			return p[0] < p[1]
+		}
+	}
+	return a.UTMMedium < b.UTMMedium
+}
+
+func TestFetchFailureCancelsOtherSource(t *testing.T) {
+	cancelled := make(chan struct{})
+	ads := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		http.Error(w, "bad request", 400)
+	}))
+	crm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer ads.Close()
+	defer crm.Close()
+
+	st := store.NewMemoryStore()
+	cfg := config.Config{AdsURL: ads.URL, CrmURL: crm.URL}
+	etl := ingest.NewETL(ingest.NewHTTPClient(10*time.Second), st, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	begin := time.Now()
+	err := etl.Run(context.Background(), nil)
+	var se *retry.StatusError
+	if !errors.As(err, &se) || se.Code != 400 {
+		t.Fatalf("want the ads 400, got %v", err)
+	}
+	if d := time.Since(begin); d > 2*time.Second {
+		t.Fatalf("run took %s: crm fetch was not cancelled", d)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("crm request context never cancelled")
+	}
+	if _, ok := etl.LastIngest("crm"); ok || len(st.All()) != 0 {
+		t.Fatal("nothing should be stored or marked fetched")
+	}
+}
@@ -0,0 +1,274 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+)
+
+func TestExportRangeResumesFromFailedBatch(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	var delivered []string // fechas recibidas, en orden
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 2 { // el segundo lote falla una vez
+			http.Error(w, "boom", 500)
+			return
+		}
+		var rows []models.Metrics
+		b, _ := io.ReadAll(r.Body)
+		json.Unmarshal(b, &rows)
+		for _, m := range rows {
+			delivered = append(delivered, m.Date)
+		}
+	}))
+	defer sink.Close()
+
+	st := store.NewMemoryStore()
+	d0, _ := time.Parse("2006-01-02", "2025-08-01")
+	for i := 0; i < 3; i++ {
+		for _, ch := range []string{"google_ads", "meta_ads"} {
+			st.UpsertAds(models.AdsPerformance{Date: d0.AddDate(0, 0, i), Channel: ch, CampaignID: "C-1",
+				Clicks: 1, UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+		}
+	}
+	cfg := config.Config{SinkURL: sink.URL, SinkSecret: "s"}
+	etl := ingest.NewETL(ingest.NewHTTPClient(2*time.Second), st, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+
+	job, err := etl.ExportRange(context.Background(), d0, d0.AddDate(0, 0, 2), models.ExportFilter{Channel: "google_ads"}, 0, false)
+	if err == nil {
+		t.Fatal("expected batch failure")
+	}
+	if job.Status != "failed" || len(job.Batches) != 3 || job.Exported != 1 || job.Batches[1].Status != "failed" {
+		t.Fatalf("unexpected job after failure: %+v", job)
+	}
+
+	job, err = etl.ResumeExport(context.Background(), job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != "done" || job.Exported != 3 || job.Batches[1].Attempts != 2 {
+		t.Fatalf("unexpected job after resume: %+v", job)
+	}
+	want := []string{"2025-08-01", "2025-08-02", "2025-08-03"}
+	if len(delivered) != len(want) {
+		t.Fatalf("delivered %v, want %v", delivered, want)
+	}
+	for i := range want {
+		if delivered[i] != want[i] {
+			t.Fatalf("delivered %v, want %v", delivered, want)
+		}
+	}
+}
+
+func TestExportLedgerSkipsUnchangedAndRetries(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	var last []models.Metrics // filas del último envío
+	fail := true
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		last = nil
+		b, _ := io.ReadAll(r.Body)
+		json.Unmarshal(b, &last)
+		if fail {
+			http.Error(w, "unavailable", 503)
+		}
+	}))
+	defer sink.Close()
+
+	st := store.NewMemoryStore()
+	d0, _ := time.Parse("2006-01-02", "2025-08-01")
+	st.UpsertAds(models.AdsPerformance{Date: d0, Channel: "google_ads", CampaignID: "C-1", Clicks: 3,
+		UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+	cfg := config.Config{SinkURL: sink.URL, SinkSecret: "s", ExportMaxAttempts: 3}
+	etl := ingest.NewETL(ingest.NewHTTPClient(2*time.Second), st, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	ctx := context.Background()
+
+	if _, err := etl.ExportDay(ctx, d0); err == nil {
+		t.Fatal("expected sink failure")
+	}
+	h := etl.ExportHistory(nil)
+	if len(h) != 1 || h[0].Status != "retrying" || h[0].ResponseCode != 503 || h[0].Attempts != 1 {
+		t.Fatalf("unexpected ledger after failure: %+v", h)
+	}
+
+	// el despachador reintenta en cuanto vence el backoff (base 0 en el test)
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	if n := etl.DispatchDue(ctx); n != 1 {
+		t.Fatalf("dispatched %d, want 1", n)
+	}
+	h = etl.ExportHistory(nil)
+	if len(h) != 1 || h[0].Status != "delivered" || h[0].Attempts != 2 {
+		t.Fatalf("unexpected ledger after retry: %+v", h)
+	}
+
+	// mismo contenido: no se reenvía; force sí
+	n, err := etl.ExportDay(ctx, d0)
+	if err != nil || n != 0 || calls != 2 {
+		t.Fatalf("unchanged re-export: n=%d err=%v calls=%d", n, err, calls)
+	}
+	job, err := etl.ExportRange(ctx, d0, d0, models.ExportFilter{}, 0, true)
+	if err != nil || job.Exported != 1 || calls != 3 {
+		t.Fatalf("forced re-export: job=%+v err=%v calls=%d", job, err, calls)
+	}
+	if h = etl.ExportHistory(nil); len(h) != 2 {
+		t.Fatalf("history len %d, want 2", len(h))
+	}
+
+	// el ledger va por día: un rango con el mismo día en otro lote sólo
+	// manda el día nuevo
+	d1 := d0.AddDate(0, 0, 1)
+	st.UpsertAds(models.AdsPerformance{Date: d1, Channel: "google_ads", CampaignID: "C-1", Clicks: 5,
+		UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+	if _, err := etl.ExportRange(ctx, d0, d1, models.ExportFilter{}, 10, false); err != nil || calls != 4 {
+		t.Fatalf("range export: err=%v calls=%d", err, calls)
+	}
+	if len(last) != 1 || last[0].Date != "2025-08-02" {
+		t.Fatalf("resent unchanged day: %+v", last)
+	}
+	if h = etl.ExportHistory(nil); h[0].Day != "2025-08-02" || h[0].To != "2025-08-02" || len(h[0].DayHashes) != 1 {
+		t.Fatalf("ledger entry: %+v", h[0])
+	}
+}
+
+func TestExportChangedResendsOnlyChangedDaysWithNewVersion(t *testing.T) {
+	var mu sync.Mutex
+	var versions []string
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		versions = append(versions, r.Header.Get("X-Export-Versions"))
+		mu.Unlock()
+	}))
+	defer sink.Close()
+
+	st := store.NewMemoryStore()
+	d0, _ := time.Parse("2006-01-02", "2025-08-01")
+	ads := func(d time.Time, clicks int) {
+		st.UpsertAds(models.AdsPerformance{Date: d, Channel: "google_ads", CampaignID: "C-1", Clicks: clicks,
+			UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+	}
+	ads(d0, 1)
+	ads(d0.AddDate(0, 0, 1), 1)
+	cfg := config.Config{SinkURL: sink.URL, SinkSecret: "s"}
+	etl := ingest.NewETL(ingest.NewHTTPClient(2*time.Second), st, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	ctx := context.Background()
+
+	if _, err := etl.ExportDay(ctx, d0); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := etl.ExportChanged(ctx); err != nil || n != 0 {
+		t.Fatalf("nothing changed: n=%d err=%v", n, err)
+	}
+
+	// llega un dato tardío para el día exportado y otro para el que nunca se exportó
+	ads(d0, 2)
+	ads(d0.AddDate(0, 0, 1), 2)
+	if got := st.ChangedDays(); len(got) != 1 || got[0] != "2025-08-01" {
+		t.Fatalf("changed days %v", got)
+	}
+	if n, err := etl.ExportChanged(ctx); err != nil || n != 1 {
+		t.Fatalf("re-export: n=%d err=%v", n, err)
+	}
+	if got := st.ChangedDays(); len(got) != 0 {
+		t.Fatalf("still changed after export: %v", got)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(versions) != 2 || versions[0] != "2025-08-01=1" || versions[1] != "2025-08-01=2" {
+		t.Fatalf("versions sent %v", versions)
+	}
+}
+
+func TestExportHistoryIsBoundedAndDropsPayloads(t *testing.T) {
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer sink.Close()
+	st := store.NewMemoryStore()
+	d0, _ := time.Parse("2006-01-02", "2025-08-01")
+	st.UpsertAds(models.AdsPerformance{Date: d0, Channel: "google_ads", CampaignID: "C-1", Clicks: 3,
+		UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+	cfg := config.Config{SinkURL: sink.URL, SinkSecret: "s", ExportJobHistory: 2, ExportLedgerHistory: 1}
+	etl := ingest.NewETL(ingest.NewHTTPClient(2*time.Second), st, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		job, err := etl.ExportRange(context.Background(), d0, d0, models.ExportFilter{}, 0, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, job.ID)
+	}
+	if _, err := etl.ExportJob(ids[0]); err != ingest.ErrJobNotFound {
+		t.Fatalf("oldest job kept: %v", err)
+	}
+	job, err := etl.ExportJob(ids[2])
+	if err != nil || job.Status != "done" || job.Batches[0].Rows != 1 || job.Batches[0].Data != nil {
+		t.Fatalf("done job should keep its summary without the payload: %+v %v", job, err)
+	}
+	// ledger: la última entrega del día más una terminada, sin payload
+	l := st.Ledger(nil)
+	if len(l) != 2 || l[0].ID != "L-3" || l[1].ID != "L-2" {
+		t.Fatalf("ledger not pruned: %+v", l)
+	}
+	for _, e := range l {
+		if e.Data != nil || e.Aggs != nil {
+			t.Fatalf("delivered entry kept its payload: %+v", e)
+		}
+	}
+}
+
+func TestExportDispatchIntervalValidated(t *testing.T) {
+	t.Setenv("EXPORT_DISPATCH_INTERVAL_SECONDS", "0")
+	cfg := config.FromEnv()
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("zero dispatch interval accepted")
+	}
+	// y el despachador no arranca en vez de hacer panic en time.NewTicker
+	etl := ingest.NewETL(nil, store.NewMemoryStore(), slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	etl.RunDispatcher(context.Background(), cfg.ExportDispatchInterval)
+}
+
+func TestExportLedgerHonoursSinkRetryAfter(t *testing.T) {
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		http.Error(w, "slow down", 429)
+	}))
+	defer sink.Close()
+	st := store.NewMemoryStore()
+	d0, _ := time.Parse("2006-01-02", "2025-08-01")
+	st.UpsertAds(models.AdsPerformance{Date: d0, Channel: "google_ads", CampaignID: "C-1", Clicks: 3,
+		UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+	cfg := config.Config{SinkURL: sink.URL, SinkSecret: "s", ExportRetryBase: time.Second}
+	etl := ingest.NewETL(ingest.NewHTTPClient(2*time.Second), st, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	ctx := context.Background()
+
+	if _, err := etl.ExportDay(ctx, d0); err == nil {
+		t.Fatal("expected sink failure")
+	}
+	h := etl.ExportHistory(nil)
+	if len(h) != 1 || h[0].Status != "retrying" || time.Until(h[0].NextAttemptAt) < 110*time.Second {
+		t.Fatalf("next attempt should follow Retry-After: %+v", h)
+	}
+	if n := etl.DispatchDue(ctx); n != 0 {
+		t.Fatalf("dispatched %d before Retry-After", n)
+	}
+}
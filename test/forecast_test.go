@@ -0,0 +1,54 @@
+package test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/AngelCh415/ELT_GO/internal/metrics"
+)
+
+func TestHoltWintersWeeklySeasonality(t *testing.T) {
+	// serie sintética: tendencia lineal + patrón semanal, sin ruido
+	pattern := []float64{10, 12, 15, 14, 13, 5, 4}
+	var y []float64
+	for i := 0; i < 8*7; i++ {
+		y = append(y, 100+0.5*float64(i)+pattern[i%7])
+	}
+
+	m, err := metrics.FitHoltWinters(y, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Period != 7 {
+		t.Fatalf("expected seasonal model, got period=%d", m.Period)
+	}
+
+	point, lower, upper := m.Predict(7, 1.96)
+	for k := 0; k < 7; k++ {
+		i := len(y) + k
+		want := 100 + 0.5*float64(i) + pattern[i%7]
+		if math.Abs(point[k]-want) > 1 {
+			t.Fatalf("h=%d: expected ~%.2f, got %.2f", k+1, want, point[k])
+		}
+		if lower[k] > point[k] || upper[k] < point[k] {
+			t.Fatalf("h=%d: interval [%.2f, %.2f] does not contain %.2f", k+1, lower[k], upper[k], point[k])
+		}
+	}
+}
+
+func TestHoltFallbackOnShortSeries(t *testing.T) {
+	m, err := metrics.FitHoltWinters([]float64{1, 2, 3, 4, 5}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Period != 0 {
+		t.Fatalf("expected non-seasonal fallback, got period=%d", m.Period)
+	}
+	point, _, _ := m.Predict(2, 1.96)
+	if math.Abs(point[0]-6) > 0.5 || math.Abs(point[1]-7) > 0.5 {
+		t.Fatalf("unexpected forecast: %v", point)
+	}
+	if _, err := metrics.FitHoltWinters([]float64{1, 2}, 7); err == nil {
+		t.Fatal("expected error on too-short series")
+	}
+}
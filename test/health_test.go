@@ -0,0 +1,73 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/health"
+)
+
+func readiness(t *testing.T, b []byte) (health.Report, map[string]health.Result) {
+	t.Helper()
+	var rep health.Report
+	if err := json.Unmarshal(b, &rep); err != nil {
+		t.Fatal(err)
+	}
+	return rep, byName(rep)
+}
+
+func byName(rep health.Report) map[string]health.Result {
+	out := map[string]health.Result{}
+	for _, c := range rep.Checks {
+		out[c.Name] = c
+	}
+	return out
+}
+
+func TestReadyzDoesNotWaitForFirstIngest(t *testing.T) {
+	h := newHarness(t, "it-secret")
+	h.do("GET", "/healthz", 200)
+
+	rep, checks := readiness(t, h.do("GET", "/readyz", 200))
+	if rep.Status != "ok" || checks["ingest_ads"].Status != "warn" || checks["ingest_ads"].Message != "never ingested" {
+		t.Fatalf("before ingest: %+v", rep)
+	}
+	if checks["config"].Status != "ok" || checks["store"].Status != "ok" || checks["sinks"].Status != "ok" {
+		t.Fatalf("before ingest: %+v", rep)
+	}
+
+	h.do("POST", "/ingest/run", 202)
+	rep, _ = readiness(t, h.do("GET", "/readyz", 200))
+	if rep.Status != "ok" {
+		t.Fatalf("after ingest: %+v", rep)
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	r := health.NewRegistry(50 * time.Millisecond)
+	r.Register("config", true, health.Config(config.Config{AdsURL: "http://ads", CrmURL: "not a url"}, nil))
+	r.Register("slow", true, func(ctx context.Context) (string, error) {
+		time.Sleep(time.Second)
+		return "late", nil
+	})
+	r.Register("optional", false, func(context.Context) (string, error) { return "", errors.New("down") })
+
+	rep := r.Run(context.Background())
+	checks := byName(rep)
+	if rep.Status != "fail" {
+		t.Fatalf("status = %s", rep.Status)
+	}
+	if c := checks["config"]; c.Status != "fail" || c.Message != "CRM_API_URL is not an absolute URL; no export sink configured" {
+		t.Fatalf("config: %+v", c)
+	}
+	if c := checks["slow"]; c.Status != "fail" || c.Message != "timeout after 50ms" {
+		t.Fatalf("slow: %+v", c)
+	}
+	if c := checks["optional"]; c.Status != "warn" {
+		t.Fatalf("optional: %+v", c)
+	}
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/AngelCh415/ELT_GO/internal/models"
+)
+
+func TestIngestPartialCommitAndReport(t *testing.T) {
+	h := newHarness(t, "it-secret")
+	const q = "?from=2025-08-01&to=2025-08-02"
+	channels := func() int {
+		var m []models.Metrics
+		if err := json.Unmarshal(h.do("GET", "/metrics/channel"+q, 200), &m); err != nil {
+			t.Fatal(err)
+		}
+		return len(m)
+	}
+	type failed struct {
+		Error  string              `json:"error"`
+		Report models.IngestReport `json:"report"`
+	}
+	source := func(rep models.IngestReport, name string) models.SourceResult {
+		for _, s := range rep.Sources {
+			if s.Source == name {
+				return s
+			}
+		}
+		t.Fatalf("no %s in %+v", name, rep)
+		return models.SourceResult{}
+	}
+
+	// sin partial: CRM caído bloquea todo
+	h.setDown("crm", true)
+	var res failed
+	if err := json.Unmarshal(h.do("POST", "/ingest/run", 502), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Report.Status != "failed" || !strings.Contains(source(res.Report, "crm").Error, "400") || source(res.Report, "ads").Committed {
+		t.Fatalf("report: %+v", res)
+	}
+	if n := channels(); n != 0 {
+		t.Fatalf("%d channel rows stored after a failed run", n)
+	}
+	ingested := func(source string) bool {
+		_, checks := readiness(t, h.do("GET", "/readyz", 200))
+		return checks["ingest_"+source].Message != "never ingested"
+	}
+	if ingested("ads") {
+		t.Fatal("ads marked as ingested without a commit")
+	}
+
+	// con partial pero ADS caído: CRM solo no se guarda
+	h.setDown("crm", false)
+	h.setDown("ads", true)
+	res = failed{}
+	if err := json.Unmarshal(h.do("POST", "/ingest/run?partial=true", 502), &res); err != nil {
+		t.Fatal(err)
+	}
+	if crm := source(res.Report, "crm"); res.Report.Status != "failed" || crm.Committed || crm.Error != "skipped: ads failed" {
+		t.Fatalf("crm committed without ads: %+v", res.Report)
+	}
+	if ingested("crm") {
+		t.Fatal("crm marked as ingested without a commit")
+	}
+	h.setDown("ads", false)
+	h.setDown("crm", true)
+
+	// con partial: ADS se guarda y el reporte dice por qué falta CRM
+	res = failed{}
+	if err := json.Unmarshal(h.do("POST", "/ingest/run?partial=true", 207), &res); err != nil {
+		t.Fatal(err)
+	}
+	ads, crm := source(res.Report, "ads"), source(res.Report, "crm")
+	if res.Report.Status != "partial" || !ads.Committed || ads.Accepted == 0 || crm.Committed || crm.Error == "" || crm.Fetched != 0 {
+		t.Fatalf("partial report: %+v", res.Report)
+	}
+	if channels() == 0 || !ingested("ads") || ingested("crm") {
+		t.Fatal("partial run should commit and mark only ads")
+	}
+
+	// CRM vuelve: ads ya estaba, todo duplicado
+	h.setDown("crm", false)
+	var rep models.IngestReport
+	if err := json.Unmarshal(h.do("POST", "/ingest/run", 202), &rep); err != nil {
+		t.Fatal(err)
+	}
+	if rep.Status != "ok" || len(rep.Sources) != 2 {
+		t.Fatalf("report: %+v", rep)
+	}
+	if ads := source(rep, "ads"); ads.Accepted != 0 || ads.Duplicates == 0 {
+		t.Fatalf("ads should be all duplicates: %+v", ads)
+	}
+	for _, s := range rep.Sources {
+		if !s.Committed || s.Error != "" || s.Fetched != s.Accepted+s.Duplicates+s.Rejected+s.Filtered {
+			t.Fatalf("counts don't add up: %+v", s)
+		}
+	}
+	if source(rep, "crm").Accepted == 0 {
+		t.Fatalf("crm: %+v", source(rep, "crm"))
+	}
+}
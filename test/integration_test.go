@@ -0,0 +1,252 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/alerts"
+	"github.com/AngelCh415/ELT_GO/internal/budget"
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/health"
+	"github.com/AngelCh415/ELT_GO/internal/httpx"
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/metrics"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/sinkrecv"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+)
+
+// go test ./test -run Integration -update regenera testdata/golden.
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// harness levanta el router real con fuentes ADS/CRM fake (fixtures de
+// testdata, modificables) y el receptor de referencia como sink.
+type harness struct {
+	t    *testing.T
+	api  *httptest.Server
+	recv *sinkrecv.Receiver
+
+	mu   sync.Mutex
+	ads  []map[string]any
+	crm  []map[string]any
+	down map[string]bool // fuentes que responden 400
+}
+
+func newHarness(t *testing.T, senderSecret string) *harness {
+	t.Helper()
+	h := &harness{t: t, down: map[string]bool{}}
+	h.ads = loadFixture(t, "ads.json")
+	h.crm = loadFixture(t, "crm.json")
+
+	serve := func(source string, rows *[]map[string]any) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if h.down[source] {
+				http.Error(w, source+" down", 400)
+				return
+			}
+			json.NewEncoder(w).Encode(*rows)
+		}
+	}
+	ads := httptest.NewServer(serve("ads", &h.ads))
+	crm := httptest.NewServer(serve("crm", &h.crm))
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h.recv = sinkrecv.New(sinkrecv.Config{Keys: map[string]string{"default": "it-secret"}}, log)
+	sink := httptest.NewServer(h.recv.Handler())
+
+	cfg := config.Config{
+		AdsURL: ads.URL, CrmURL: crm.URL,
+		SinkURL: sink.URL, SinkSecret: senderSecret, SinkKeyID: "default",
+		AnomalyMethod: "mad", AnomalyWindow: 7, AnomalySensitivity: 3,
+	}
+	cl := ingest.NewHTTPClient(2 * time.Second)
+	st := store.NewMemoryStore()
+	etl := ingest.NewETL(cl, st, log, cfg)
+	etl.OnComplete(func(ctx context.Context) { etl.ExportChanged(ctx) })
+	mSvc := metrics.NewService(st, cfg)
+	hSvc := health.NewRegistry(time.Second)
+	hSvc.Register("config", true, health.Config(cfg, etl.Sinks()))
+	hSvc.Register("ingest_ads", false, health.Ingest(etl, "ads", time.Hour))
+	hSvc.Register("ingest_crm", false, health.Ingest(etl, "crm", time.Hour))
+	hSvc.Register("store", true, health.Store(st))
+	hSvc.Register("sinks", false, health.Sinks(etl.Sinks()))
+	h.api = httptest.NewServer(httpx.NewRouter(httpx.Deps{
+		Log: log, ETL: etl, Metrics: mSvc,
+		Budgets: budget.NewService(st, cfg), Alerts: alerts.NewService(cl, mSvc, log, cfg),
+		Health: hSvc,
+	}))
+	t.Cleanup(func() {
+		h.api.Close()
+		ads.Close()
+		crm.Close()
+		sink.Close()
+	})
+	return h
+}
+
+func (h *harness) do(method, path string, wantCode int) []byte {
+	h.t.Helper()
+	req, _ := http.NewRequest(method, h.api.URL+path, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != wantCode {
+		h.t.Fatalf("%s %s: %d %s (want %d)", method, path, resp.StatusCode, b, wantCode)
+	}
+	return b
+}
+
+func (h *harness) setDown(source string, down bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.down[source] = down
+}
+
+func (h *harness) addCRM(row map[string]any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.crm = append(h.crm, row)
+}
+
+// stored devuelve los payloads aceptados por el receptor, decodificados.
+func (h *harness) stored() [][]models.Metrics {
+	var out [][]models.Metrics
+	for _, r := range h.recv.Received() {
+		if r.Status != "stored" {
+			continue
+		}
+		b, _ := h.recv.Body(r.ID)
+		var rows []models.Metrics
+		if err := json.Unmarshal(b, &rows); err != nil {
+			h.t.Fatal(err)
+		}
+		out = append(out, rows)
+	}
+	return out
+}
+
+func TestIntegrationIngestMetricsExport(t *testing.T) {
+	h := newHarness(t, "it-secret")
+	const q = "?from=2025-08-01&to=2025-08-02"
+
+	h.do("POST", "/ingest/run", 202)
+	assertGolden(t, "channel.json", h.do("GET", "/metrics/channel"+q, 200))
+	assertGolden(t, "funnel.json", h.do("GET", "/metrics/funnel"+q, 200))
+
+	// UTMs faltantes: ads y CRM se cruzan en el triple "unknown"
+	var unknown []models.Metrics
+	json.Unmarshal(h.do("GET", "/metrics/funnel"+q+"&utm_campaign=unknown", 200), &unknown)
+	if len(unknown) != 1 || unknown[0].Channel != "meta_ads" || unknown[0].Opportunities != 1 {
+		t.Fatalf("missing UTMs row: %+v", unknown)
+	}
+
+	// date= conserva la respuesta original; el job completo va en /export/jobs
+	var res struct {
+		Exported int    `json:"exported"`
+		Job      string `json:"job"`
+	}
+	json.Unmarshal(h.do("POST", "/export/run?date=2025-08-01", 200), &res)
+	var job models.ExportJob
+	json.Unmarshal(h.do("GET", "/export/jobs/"+res.Job, 200), &job)
+	if res.Exported != 2 || job.Status != "done" || job.Exported != 2 {
+		t.Fatalf("export: %+v job: %+v", res, job)
+	}
+	h.do("POST", "/export/run?from=2025-08-02&to=2025-08-01", 400)
+	h.do("POST", "/export/run?resume=X-404", 404)
+	payloads := h.stored()
+	if len(payloads) != 1 {
+		t.Fatalf("receiver stored %d payloads", len(payloads))
+	}
+	assertGoldenValue(t, "export_2025-08-01.json", payloads[0])
+
+	// reprocesar lo mismo no duplica nada ni reexporta
+	h.do("POST", "/ingest/run", 202)
+	assertGolden(t, "channel.json", h.do("GET", "/metrics/channel"+q, 200))
+	if n := len(h.stored()); n != 1 {
+		t.Fatalf("re-ingest of same data exported again (%d payloads)", n)
+	}
+
+	// un cierre tardío para el día exportado: cambia métricas y se reexporta solo
+	h.addCRM(map[string]any{"opportunity_id": "O-8", "stage": "closed_won", "amount": 200,
+		"created_at": "2025-08-01T18:00:00Z", "utm_campaign": "summer", "utm_source": "facebook", "utm_medium": "paid_social"})
+	h.do("POST", "/ingest/run", 202)
+	assertGolden(t, "channel_reprocessed.json", h.do("GET", "/metrics/channel"+q, 200))
+	payloads = h.stored()
+	if len(payloads) != 2 {
+		t.Fatalf("changed day not re-exported (%d payloads)", len(payloads))
+	}
+	assertGoldenValue(t, "export_2025-08-01_v2.json", payloads[1])
+}
+
+func TestIntegrationSinceFilter(t *testing.T) {
+	h := newHarness(t, "it-secret")
+	h.do("POST", "/ingest/run?since=2025-08-02", 202)
+	assertGolden(t, "channel_since.json", h.do("GET", "/metrics/channel?from=2025-08-01&to=2025-08-02", 200))
+}
+
+func TestIntegrationSinkRejectsBadSignature(t *testing.T) {
+	h := newHarness(t, "wrong-secret")
+	h.do("POST", "/ingest/run", 202)
+	h.do("POST", "/export/run?date=2025-08-01", 502)
+	if got := h.recv.Received(); len(got) != 0 {
+		t.Fatalf("receiver accepted a payload signed with the wrong key: %+v", got)
+	}
+}
+
+func loadFixture(t *testing.T, name string) []map[string]any {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal(b, &rows); err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func assertGolden(t *testing.T, name string, body []byte) {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("%s: response is not JSON: %s", name, body)
+	}
+	assertGoldenValue(t, name, v)
+}
+
+// assertGoldenValue compara v (re-serializado con indentación) con
+// testdata/golden/<name>.
+func assertGoldenValue(t *testing.T, name string, v any) {
+	t.Helper()
+	got, _ := json.MarshalIndent(v, "", "  ")
+	got = append(got, '\n')
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create it)", err)
+	}
+	if string(want) != string(got) {
+		t.Errorf("%s mismatch\n--- want\n%s\n--- got\n%s", name, want, got)
+	}
+}
@@ -0,0 +1,49 @@
+package test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/metrics"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+)
+
+func TestVelocityUsesCRMAndObservedTransitions(t *testing.T) {
+	st := store.NewMemoryStore()
+	created, _ := time.Parse("2006-01-02", "2025-08-01")
+	st.UpsertAds(models.AdsPerformance{Date: created, Channel: "google_ads", CampaignID: "C-1",
+		UTMCampaign: "camp", UTMSource: "src", UTMMedium: "med"})
+
+	// O-1: historial completo desde el CRM (2 días a opp, 10 a won)
+	st.TrackOpportunity("O-1", models.Opportunity{Stage: "closed_won", CreatedAt: created,
+		UTMCampaign: "camp", UTMSource: "src", UTMMedium: "med",
+		StageHistory: map[string]time.Time{"opportunity": created.AddDate(0, 0, 2), "closed_won": created.AddDate(0, 0, 12)},
+	}, created.AddDate(0, 0, 20))
+	// O-2: transición observada entre dos ingestas (4 días a opp)
+	st.TrackOpportunity("O-2", models.Opportunity{Stage: "lead", CreatedAt: created,
+		UTMCampaign: "camp", UTMSource: "src", UTMMedium: "med"}, created)
+	st.TrackOpportunity("O-2", models.Opportunity{Stage: "opportunity", CreatedAt: created,
+		UTMCampaign: "camp", UTMSource: "src", UTMMedium: "med"}, created.AddDate(0, 0, 4))
+	// O-3: ya era opportunity la primera vez que se vio: no cuenta
+	st.TrackOpportunity("O-3", models.Opportunity{Stage: "opportunity", CreatedAt: created,
+		UTMCampaign: "camp", UTMSource: "src", UTMMedium: "med"}, created.AddDate(0, 0, 30))
+
+	svc := metrics.NewService(st, config.Config{})
+	rows, err := svc.Velocity(url.Values{"group": {"channel"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Channel != "google_ads" {
+		t.Fatalf("unexpected groups: %+v", rows)
+	}
+	v := rows[0]
+	if v.LeadToOpp.Count != 2 || v.LeadToOpp.MedianDays != 3 || v.LeadToOpp.P90Days != 3.8 {
+		t.Fatalf("lead_to_opportunity: %+v", v.LeadToOpp)
+	}
+	if v.OppToWon.Count != 1 || v.OppToWon.MedianDays != 10 {
+		t.Fatalf("opportunity_to_closed_won: %+v", v.OppToWon)
+	}
+}
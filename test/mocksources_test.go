@@ -0,0 +1,80 @@
+package test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/mocksrc"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+)
+
+func TestMockSourcesDeterministicAndIngestible(t *testing.T) {
+	start, _ := time.Parse("2006-01-02", "2025-08-01")
+	gen := mocksrc.DefaultGenConfig()
+	gen.Seed, gen.Start, gen.Days, gen.BadRows, gen.MissingUTM = 7, start, 5, 0.1, 0.1
+	a, b := mocksrc.Generate(gen), mocksrc.Generate(gen)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatal("same seed produced different data")
+	}
+	if len(a.Ads) != 5*3*2 || len(a.CRM) == 0 {
+		t.Fatalf("ads=%d crm=%d", len(a.Ads), len(a.CRM))
+	}
+
+	// el primer request de cada endpoint falla: lo absorbe el retry del ETL
+	srv := mocksrc.NewServer(a, mocksrc.Faults{FailFirst: 1}, 7)
+	hs := httptest.NewServer(srv.Handler())
+	defer hs.Close()
+
+	st := store.NewMemoryStore()
+	cfg := config.Config{AdsURL: hs.URL + "/ads", CrmURL: hs.URL + "/crm"}
+	etl := ingest.NewETL(ingest.NewHTTPClient(2*time.Second), st, slog.New(slog.NewTextHandler(io.Discard, nil)), cfg)
+	if err := etl.Run(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Calls("ads") != 2 || srv.Calls("crm") != 2 {
+		t.Fatalf("calls ads=%d crm=%d", srv.Calls("ads"), srv.Calls("crm"))
+	}
+	aggs := st.All()
+	if len(aggs) == 0 {
+		t.Fatal("nothing ingested")
+	}
+	for _, g := range aggs {
+		if g.Clicks < 0 || g.Cost < 0 || g.Revenue < 0 {
+			t.Fatalf("bad row leaked into aggregates: %+v", g)
+		}
+	}
+}
+
+func TestMockSourcesZeroRatesAndNoiseClamp(t *testing.T) {
+	start, _ := time.Parse("2006-01-02", "2025-08-01")
+	gen := mocksrc.DefaultGenConfig()
+	gen.Start, gen.Days, gen.BadRows = start, 30, 0
+	// tasa en 0 explícita = sin ventas, y ruido fuera de rango no rompe el CTR
+	gen.WinRate, gen.Noise = 0, 5
+	d := mocksrc.Generate(gen)
+	if len(d.CRM) == 0 {
+		t.Fatal("expected leads")
+	}
+	for _, o := range d.CRM {
+		if o.Stage == "closed_won" {
+			t.Fatalf("win with WinRate 0: %+v", o)
+		}
+	}
+	for _, a := range d.Ads {
+		if a.Impressions < a.Clicks || a.Impressions > a.Clicks*1000 {
+			t.Fatalf("impressions out of range: %+v", a)
+		}
+	}
+
+	gen.LeadRate = 0
+	if d := mocksrc.Generate(gen); len(d.CRM) != 0 {
+		t.Fatalf("LeadRate 0 generated %d leads", len(d.CRM))
+	}
+}
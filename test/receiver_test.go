@@ -0,0 +1,100 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/export"
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/sinkrecv"
+	"github.com/AngelCh415/ELT_GO/pkg/signature"
+)
+
+func TestReceiverVerifiesDedupesAndDropsStale(t *testing.T) {
+	dir := t.TempDir()
+	rv := sinkrecv.New(sinkrecv.Config{Keys: map[string]string{"k1": "s3cret"}, Dir: dir}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	srv := httptest.NewServer(rv.Handler())
+	defer srv.Close()
+
+	cl := ingest.NewHTTPClient(2 * time.Second)
+	s := export.NewHTTPSink(cl, srv.URL, []signature.Key{{ID: "k1", Secret: "s3cret"}}, export.Format{Kind: "ndjson", Gzip: true})
+	b := export.Batch{Seq: 1, From: "2025-08-01", To: "2025-08-01", Versions: map[string]int{"2025-08-01": 2},
+		Rows: []models.Metrics{{Date: "2025-08-01", Channel: "google_ads"}, {Date: "2025-08-01", Channel: "meta_ads"}}}
+	ctx := context.Background()
+
+	if err := s.Write(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write(ctx, b); err != nil { // reintento del emisor: misma clave, otra firma
+		t.Fatal(err)
+	}
+	old := b
+	old.Versions = map[string]int{"2025-08-01": 1}
+	old.Rows = b.Rows[:1]
+	if err := s.Write(ctx, old); err != nil {
+		t.Fatal(err)
+	}
+
+	got := rv.Received()
+	if len(got) != 3 || got[0].Status != "stored" || got[1].Status != "duplicate" || got[2].Status != "stale" {
+		t.Fatalf("unexpected receptions: %+v", got)
+	}
+	if got[0].Rows != 2 || got[0].File == "" {
+		t.Fatalf("first reception: %+v", got[0])
+	}
+	if _, err := os.Stat(got[0].File); err != nil {
+		t.Fatal(err)
+	}
+
+	// firma mala y repetición exacta de un request ya aceptado
+	body := []byte(`[]`)
+	h := http.Header{}
+	signature.SetHeaders(h, []signature.Key{{ID: "k1", Secret: "wrong"}}, time.Now(), body)
+	if code := post(t, srv.URL, h, body); code != 401 {
+		t.Fatalf("bad signature: %d", code)
+	}
+	h = http.Header{}
+	signature.SetHeaders(h, []signature.Key{{ID: "k1", Secret: "s3cret"}}, time.Now(), body)
+	if code := post(t, srv.URL, h, body); code != 200 {
+		t.Fatalf("first post: %d", code)
+	}
+	if code := post(t, srv.URL, h, body); code != 409 {
+		t.Fatalf("replay: %d", code)
+	}
+
+	// las versiones van firmadas: inflarlas en tránsito o mandarlas sin
+	// firmar se rechaza
+	h = http.Header{}
+	h.Set("X-Export-Versions", "2025-08-02=1")
+	signature.SetHeaders(h, []signature.Key{{ID: "k1", Secret: "s3cret"}}, time.Now(), body, "X-Export-Versions")
+	h.Set("X-Export-Versions", "2025-08-02=99")
+	if code := post(t, srv.URL, h, body); code != 401 {
+		t.Fatalf("tampered versions: %d", code)
+	}
+	h = http.Header{}
+	signature.SetHeaders(h, []signature.Key{{ID: "k1", Secret: "s3cret"}}, time.Now(), body)
+	h.Set("X-Export-Versions", "2025-08-02=99")
+	if code := post(t, srv.URL, h, body); code != 401 {
+		t.Fatalf("unsigned versions: %d", code)
+	}
+}
+
+func post(t *testing.T, url string, h http.Header, body []byte) int {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	req.Header = h
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
@@ -0,0 +1,127 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/retry"
+)
+
+// flaky responde code las primeras fails veces y luego [].
+func flaky(t *testing.T, code, fails int, hdr map[string]string) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(atomic.AddInt32(&calls, 1)) <= fails {
+			for k, v := range hdr {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(code)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetryPolicyStatusClassification(t *testing.T) {
+	p := retry.Policy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	cl := ingest.NewHTTPClient(2 * time.Second)
+	var dst []any
+
+	srv, calls := flaky(t, 503, 2, nil)
+	if err := ingest.GetJSONWithRetry(context.Background(), cl, p, "ads", srv.URL, &dst); err != nil || *calls != 3 {
+		t.Fatalf("503: err=%v calls=%d", err, *calls)
+	}
+
+	// 4xx no se reintenta (salvo 408/425/429)
+	srv, calls = flaky(t, 404, 10, nil)
+	err := ingest.GetJSONWithRetry(context.Background(), cl, p, "ads", srv.URL, &dst)
+	var se *retry.StatusError
+	if !errors.As(err, &se) || se.Code != 404 || *calls != 1 {
+		t.Fatalf("404: err=%v calls=%d", err, *calls)
+	}
+
+	srv, calls = flaky(t, 429, 10, nil)
+	if err := ingest.GetJSONWithRetry(context.Background(), cl, p, "ads", srv.URL, &dst); err == nil || *calls != 4 {
+		t.Fatalf("429: err=%v calls=%d, want 4 attempts", err, *calls)
+	}
+}
+
+func TestRetryPolicyHonoursRetryAfterAndContext(t *testing.T) {
+	// Retry-After: 1 dentro de MaxDelay: espera el segundo, no el jitter de 1ms
+	srv, calls := flaky(t, 503, 1, map[string]string{"Retry-After": "1"})
+	p := retry.Policy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second}
+	start := time.Now()
+	var dst []any
+	if err := ingest.GetJSONWithRetry(context.Background(), ingest.NewHTTPClient(2*time.Second), p, "crm", srv.URL, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < time.Second || *calls != 2 {
+		t.Fatalf("waited %s over %d calls, want the full Retry-After", d, *calls)
+	}
+
+	// mayor que MaxDelay: no se reintenta antes de tiempo y el error lo lleva
+	srv, calls = flaky(t, 503, 1, map[string]string{"Retry-After": "1"})
+	p.MaxDelay = 300 * time.Millisecond
+	start = time.Now()
+	err := ingest.GetJSONWithRetry(context.Background(), ingest.NewHTTPClient(2*time.Second), p, "crm", srv.URL, &dst)
+	var se *retry.StatusError
+	if !errors.As(err, &se) || se.RetryAfter != time.Second || *calls != 1 || time.Since(start) > 200*time.Millisecond {
+		t.Fatalf("err=%v calls=%d after %s, want an immediate failure", err, *calls, time.Since(start))
+	}
+
+	// cancelar ctx corta la espera entre intentos
+	srv, _ = flaky(t, 503, 10, nil)
+	p = retry.Policy{MaxAttempts: 5, BaseDelay: 10 * time.Second, MaxDelay: 10 * time.Second}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	err = ingest.GetJSONWithRetry(ctx, ingest.NewHTTPClient(2*time.Second), p, "crm", srv.URL, &dst)
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 2*time.Second {
+		t.Fatalf("err=%v after %s", err, time.Since(start))
+	}
+}
+
+func TestRetryDelayAndRetryAfterParsing(t *testing.T) {
+	p := retry.Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt := 1; attempt <= 40; attempt++ {
+		if d := p.Delay(attempt); d < 0 || d >= time.Second {
+			t.Fatalf("attempt %d: delay %s out of [0, 1s)", attempt, d)
+		}
+	}
+	now := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	for in, want := range map[string]time.Duration{
+		"":                              0,
+		"7":                             7 * time.Second,
+		"-3":                            0,
+		"Fri, 01 Aug 2025 12:00:30 GMT": 30 * time.Second,
+		"Fri, 01 Aug 2025 11:00:00 GMT": 0,
+		"soon":                          0,
+	} {
+		if got := retry.ParseRetryAfter(in, now); got != want {
+			t.Errorf("ParseRetryAfter(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestRetryPolicyFromConfig(t *testing.T) {
+	cfg := config.Config{Retry: map[string]config.RetryConfig{
+		"sink": {MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: time.Minute},
+	}}
+	if got := cfg.RetryPolicy("sink"); got.MaxAttempts != 4 || got.BaseDelay != time.Second || got.MaxDelay != time.Minute {
+		t.Fatalf("sink policy = %+v", got)
+	}
+	// sin configurar, el default del destino
+	if got := cfg.RetryPolicy("ads"); got.MaxAttempts != 3 || got.BaseDelay != 200*time.Millisecond || got.MaxDelay != 5*time.Second {
+		t.Fatalf("ads policy = %+v", got)
+	}
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+)
+
+// slowSources sirve ADS/CRM; /ads se bloquea hasta cerrar release.
+func slowSources(t *testing.T, release chan struct{}) config.Config {
+	t.Helper()
+	ads := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte(`[{"date":"2025-08-01","campaign_id":"C1","channel":"google_ads","clicks":10,"impressions":100,"cost":5,"utm_campaign":"x","utm_source":"google","utm_medium":"cpc"}]`))
+	}))
+	crm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`[]`)) }))
+	t.Cleanup(func() { ads.Close(); crm.Close() })
+	return config.Config{AdsURL: ads.URL, CrmURL: crm.URL}
+}
+
+func TestShutdownDrainsRunningIngest(t *testing.T) {
+	release := make(chan struct{})
+	st := store.NewMemoryStore()
+	etl := ingest.NewETL(ingest.NewHTTPClient(5*time.Second), st, slog.New(slog.NewTextHandler(io.Discard, nil)), slowSources(t, release))
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- etl.Run(context.Background(), nil) }()
+	time.Sleep(50 * time.Millisecond) // Run ya está esperando a /ads
+
+	shut := make(chan error, 1)
+	go func() { shut <- etl.Shutdown(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+	if err := etl.Run(context.Background(), nil); !errors.Is(err, ingest.ErrShuttingDown) {
+		t.Fatalf("new run during shutdown: %v", err)
+	}
+	select {
+	case err := <-shut:
+		t.Fatalf("shutdown returned %v before the run finished", err)
+	default:
+	}
+
+	close(release)
+	if err := <-runErr; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-shut; err != nil {
+		t.Fatal(err)
+	}
+	if aggs, _, _ := st.Counts(); aggs != 1 {
+		t.Fatalf("aggs = %d, want the drained run committed", aggs)
+	}
+}
+
+func TestShutdownDeadlineCancelsBeforeStoreWrites(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	st := store.NewMemoryStore()
+	etl := ingest.NewETL(ingest.NewHTTPClient(5*time.Second), st, slog.New(slog.NewTextHandler(io.Discard, nil)), slowSources(t, release))
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- etl.Run(context.Background(), nil) }()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := etl.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if err := <-runErr; err == nil {
+		t.Fatal("cancelled run reported success")
+	}
+	if aggs, _, _ := st.Counts(); aggs != 0 {
+		t.Fatalf("aggs = %d, store touched by a cancelled run", aggs)
+	}
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/export"
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+	"github.com/AngelCh415/ELT_GO/pkg/signature"
+)
+
+func TestSignatureVerify(t *testing.T) {
+	body := []byte(`[{"date":"2025-08-01"}]`)
+	now := time.Unix(1754000000, 0)
+	h := http.Header{}
+	signature.SetHeaders(h, []signature.Key{{ID: "k2", Secret: "new"}, {ID: "k1", Secret: "old"}}, now, body)
+
+	// receptor que aún sólo conoce la clave vieja y otro que ya sólo conoce la nueva
+	for _, keys := range []map[string]string{{"k1": "old"}, {"k2": "new"}} {
+		if err := signature.Verify(h, body, keys, time.Minute, now.Add(30*time.Second)); err != nil {
+			t.Fatalf("keys %v: %v", keys, err)
+		}
+	}
+	cases := []struct {
+		name string
+		keys map[string]string
+		body []byte
+		at   time.Time
+		want error
+	}{
+		{"replay", map[string]string{"k1": "old"}, body, now.Add(10 * time.Minute), signature.ErrExpired},
+		{"tampered", map[string]string{"k1": "old"}, []byte(`[]`), now, signature.ErrMismatch},
+		{"wrong secret", map[string]string{"k1": "nope"}, body, now, signature.ErrMismatch},
+		{"unknown key", map[string]string{"k9": "x"}, body, now, signature.ErrUnknownKey},
+	}
+	for _, c := range cases {
+		if err := signature.Verify(h, c.body, c.keys, time.Minute, c.at); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+	if err := signature.Verify(http.Header{}, body, map[string]string{"k1": "old"}, 0, now); !errors.Is(err, signature.ErrMissingHeaders) {
+		t.Errorf("no headers: got %v", err)
+	}
+}
+
+func TestHTTPSinkSignsWithTimestampAndKeyID(t *testing.T) {
+	var verr error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, verr = signature.VerifyRequest(r, map[string]string{"prod-2": "s3cret"}, 0)
+	}))
+	defer srv.Close()
+
+	keys, err := signature.ParseKeys([]string{"prod-2:s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := export.NewHTTPSink(ingest.NewHTTPClient(2*time.Second), srv.URL, keys, export.Format{Kind: "json"})
+	if err := s.Write(context.Background(), export.Batch{Seq: 1, From: "2025-08-01", To: "2025-08-01",
+		Rows: []models.Metrics{{Date: "2025-08-01", Channel: "google_ads"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if verr != nil {
+		t.Fatalf("receiver rejected signature: %v", verr)
+	}
+}
+
+func TestBadExtraSinkKeysAreReported(t *testing.T) {
+	t.Setenv("SINK_EXTRA_SECRETS", "old-secret-without-id")
+	cfg := config.FromEnv()
+	cfg.SinkURL, cfg.SinkSecret = "http://sink.invalid", "s"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("bad SINK_EXTRA_SECRETS accepted")
+	}
+	var logs bytes.Buffer
+	etl := ingest.NewETL(nil, store.NewMemoryStore(), slog.New(slog.NewTextHandler(&logs, nil)), cfg)
+	if len(etl.Sinks()) != 0 || !bytes.Contains(logs.Bytes(), []byte("export sink disabled")) {
+		t.Fatalf("sinks=%d logs=%q", len(etl.Sinks()), logs.String())
+	}
+}
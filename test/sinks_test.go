@@ -0,0 +1,317 @@
+package test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+
+	"github.com/AngelCh415/ELT_GO/internal/config"
+	"github.com/AngelCh415/ELT_GO/internal/export"
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/models"
+	"github.com/AngelCh415/ELT_GO/internal/store"
+	"github.com/AngelCh415/ELT_GO/pkg/signature"
+)
+
+var sinkRows = []models.Metrics{
+	{Date: "2025-08-01", Channel: "google_ads", CampaignID: "C-1", Clicks: 10, Cost: 12.5},
+	{Date: "2025-08-01", Channel: "meta_ads", CampaignID: "C-2", Clicks: 5, Cost: 3},
+	{Date: "2025-08-02", Channel: "google_ads", CampaignID: "C-1", Clicks: 7, Cost: 9.25},
+}
+
+func TestFileSinkPartitionsByDay(t *testing.T) {
+	dir := t.TempDir()
+	f, _ := export.ParseFormat("ndjson.gz")
+	sink := export.NewFileSink(dir, f)
+	if err := sink.Write(context.Background(), export.Batch{Seq: 1, From: "2025-08-01", To: "2025-08-02", Part: "all", Rows: sinkRows}); err != nil {
+		t.Fatal(err)
+	}
+
+	for day, want := range map[string]int{"2025-08-01": 2, "2025-08-02": 1} {
+		fh, err := os.Open(filepath.Join(dir, "date="+day, "part-all.ndjson.gz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		sc := bufio.NewScanner(zr)
+		for sc.Scan() {
+			n++
+		}
+		fh.Close()
+		if n != want {
+			t.Fatalf("%s: expected %d lines, got %d", day, want, n)
+		}
+	}
+}
+
+func TestS3SinkPutsSignedObjects(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	// stand-in local de S3: acepta PUT path-style y exige firma SigV4
+	s3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if r.Method != http.MethodPut || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AK/") || r.Header.Get("x-amz-content-sha256") == "" {
+			http.Error(w, "denied", 403)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		objects[r.URL.EscapedPath()] = b
+		mu.Unlock()
+	}))
+	defer s3.Close()
+
+	f, _ := export.ParseFormat("csv")
+	sink := export.NewS3Sink(&http.Client{Timeout: 2 * time.Second}, export.S3Config{
+		Endpoint: s3.URL, Bucket: "lake", Prefix: "metrics", AccessKey: "AK", SecretKey: "SK",
+	}, f)
+	if err := sink.Write(context.Background(), export.Batch{Seq: 3, Part: "3f9a", Rows: sinkRows}); err != nil {
+		t.Fatal(err)
+	}
+
+	body, ok := objects["/lake/metrics/date%3D2025-08-01/part-3f9a.csv"]
+	if !ok || len(objects) != 2 {
+		t.Fatalf("unexpected objects: %v", keys(objects))
+	}
+	recs, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 || recs[0][0] != "date" || recs[1][8] != "12.5" {
+		t.Fatalf("unexpected csv: %v", recs)
+	}
+}
+
+func TestFileSinkReexportsReplaceDayPartition(t *testing.T) {
+	dir := t.TempDir()
+	f, _ := export.ParseFormat("json")
+	st := store.NewMemoryStore()
+	d0, _ := time.Parse("2006-01-02", "2025-08-01")
+	for i := 0; i < 3; i++ {
+		for _, ch := range []string{"google_ads", "meta_ads"} {
+			st.UpsertAds(models.AdsPerformance{Date: d0.AddDate(0, 0, i), Channel: ch, CampaignID: "C-1",
+				Clicks: 1 + i, UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+		}
+	}
+	etl := ingest.NewETL(nil, st, slog.New(slog.NewTextHandler(io.Discard, nil)), config.Config{}, export.NewFileSink(dir, f))
+	ctx := context.Background()
+	run := func(from, to time.Time, fl models.ExportFilter, batchRows int) {
+		if _, err := etl.ExportRange(ctx, from, to, fl, batchRows, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// el mismo día por rangos superpuestos, con lotes distintos y con filtro
+	run(d0, d0.AddDate(0, 0, 1), models.ExportFilter{}, 0)
+	run(d0.AddDate(0, 0, 1), d0.AddDate(0, 0, 2), models.ExportFilter{}, 3)
+	run(d0.AddDate(0, 0, 1), d0.AddDate(0, 0, 1), models.ExportFilter{Channel: "google_ads"}, 0)
+	st.UpsertAds(models.AdsPerformance{Date: d0.AddDate(0, 0, 1), Channel: "tiktok_ads", CampaignID: "C-9",
+		Clicks: 4, UTMCampaign: "c", UTMSource: "s", UTMMedium: "m"})
+	run(d0, d0.AddDate(0, 0, 2), models.ExportFilter{}, 1)
+
+	part := filepath.Join(dir, "date=2025-08-02")
+	parts, _ := filepath.Glob(filepath.Join(part, "part-*"))
+	if len(parts) != 2 {
+		t.Fatalf("want the unfiltered and the google_ads part, got %v", parts)
+	}
+	var rows []models.Metrics
+	b, _ := os.ReadFile(filepath.Join(part, "part-all.json"))
+	if err := json.Unmarshal(b, &rows); err != nil || len(rows) != 3 {
+		t.Fatalf("unfiltered part should hold the whole current day once: %d rows %v", len(rows), err)
+	}
+}
+
+func keys(m map[string][]byte) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
+
+func TestFileSinkParquetWritesBothTables(t *testing.T) {
+	dir := t.TempDir()
+	f, err := export.ParseFormat("parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ := time.Parse("2006-01-02", "2025-08-01")
+	var rows []models.Metrics
+	var aggs []models.DailyAgg
+	for i := 0; i < 20; i++ {
+		c := fmt.Sprintf("C-%d", i)
+		rows = append(rows, models.Metrics{Date: "2025-08-01", Channel: "google_ads", CampaignID: c, Clicks: 10 + i,
+			Cost: 12.5 + float64(i), Leads: 2, CPC: 1.2345, CPA: 6.25, ROAS: 0.5})
+		aggs = append(aggs, models.DailyAgg{Key: models.DailyAggKey{Date: d, Channel: "google_ads", CampaignID: c},
+			Clicks: 10 + i, Cost: 12.3456, Revenue: 99.99})
+	}
+	sink := export.NewFileSink(dir, f)
+	if err := sink.Write(context.Background(), export.Batch{Seq: 1, Rows: rows, Aggs: aggs}); err != nil {
+		t.Fatal(err)
+	}
+
+	// esquema leído del footer: DATE sobre INT32, DECIMAL(18,s) sobre INT64,
+	// contadores INT64
+	type col struct {
+		phys  format.Type
+		scale int32 // -1: no es decimal
+		date  bool
+	}
+	date, count := col{format.Int32, -1, true}, col{format.Int64, -1, false}
+	dec := func(s int32) col { return col{format.Int64, s, false} }
+	want := map[string]map[string]col{
+		"metrics": {"date": date, "clicks": count, "impressions": count, "leads": count, "closed_won": count,
+			"cost": dec(2), "revenue": dec(2), "cpc": dec(4), "cpa": dec(2), "roas": dec(4)},
+		"daily_agg": {"date": date, "clicks": count, "leads": count, "cost": dec(4), "revenue": dec(4)},
+	}
+	open := func(table string) (*os.File, int64) {
+		fh, err := os.Open(filepath.Join(dir, table, "date=2025-08-01", "part-all.parquet"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { fh.Close() })
+		st, _ := fh.Stat()
+		pf, err := parquet.OpenFile(fh, st.Size())
+		if err != nil {
+			t.Fatalf("%s: %v", table, err)
+		}
+		if pf.NumRows() != 20 {
+			t.Fatalf("%s: %d rows", table, pf.NumRows())
+		}
+		got := map[string]format.SchemaElement{}
+		for _, el := range pf.Metadata().Schema[1:] {
+			got[el.Name] = el
+		}
+		for name, c := range want[table] {
+			el, ok := got[name]
+			if !ok || el.Type == nil || *el.Type != c.phys {
+				t.Fatalf("%s.%s: physical type %+v", table, name, el.Type)
+			}
+			lt := el.LogicalType
+			if c.date != (lt != nil && lt.Date != nil) {
+				t.Fatalf("%s.%s: logical type %+v", table, name, lt)
+			}
+			if c.scale >= 0 && (lt == nil || lt.Decimal == nil || lt.Decimal.Scale != c.scale || lt.Decimal.Precision != 18) {
+				t.Fatalf("%s.%s: want DECIMAL(18,%d), got %+v", table, name, c.scale, lt)
+			}
+			if c.scale < 0 && !c.date && lt != nil && (lt.Integer == nil || lt.Integer.BitWidth != 64 || !lt.Integer.IsSigned) {
+				t.Fatalf("%s.%s: signed INT64 expected, got %+v", table, name, lt)
+			}
+		}
+		return fh, st.Size()
+	}
+
+	type metricsRow struct {
+		Date       int32  `parquet:"date,date"`
+		CampaignID string `parquet:"campaign_id"`
+		Clicks     int64  `parquet:"clicks"`
+		Cost       int64  `parquet:"cost,decimal(2:18)"`
+		CPC        int64  `parquet:"cpc,decimal(4:18)"`
+	}
+	days := int32(d.Unix() / 86400)
+	mr, err := parquet.Read[metricsRow](open("metrics"))
+	if err != nil || len(mr) != 20 {
+		t.Fatalf("metrics: %v, %d rows", err, len(mr))
+	}
+	if m := mr[3]; m.Date != days || m.CampaignID != "C-3" || m.Clicks != 13 || m.Cost != 1550 || m.CPC != 12345 {
+		t.Fatalf("metrics row: %+v", m)
+	}
+
+	type aggRow struct {
+		Date    int32 `parquet:"date,date"`
+		Clicks  int64 `parquet:"clicks"`
+		Cost    int64 `parquet:"cost,decimal(4:18)"`
+		Revenue int64 `parquet:"revenue,decimal(4:18)"`
+	}
+	ar, err := parquet.Read[aggRow](open("daily_agg"))
+	if err != nil || len(ar) != 20 {
+		t.Fatalf("daily_agg: %v, %d rows", err, len(ar))
+	}
+	if a := ar[19]; a.Date != days || a.Clicks != 29 || a.Cost != 123456 || a.Revenue != 999900 {
+		t.Fatalf("daily_agg row: %+v", a)
+	}
+
+	if _, err := export.ParseFormat("parquet.gz"); err == nil {
+		t.Fatal("expected parquet.gz to be rejected")
+	}
+}
+
+func TestHTTPSinkChunksWithIdempotencyKeysAndManifest(t *testing.T) {
+	type req struct {
+		key, chunk string
+		manifest   bool
+		body       []byte
+	}
+	var mu sync.Mutex
+	var got []req
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		got = append(got, req{r.Header.Get("Idempotency-Key"), r.Header.Get("X-Export-Chunk"), r.Header.Get("X-Export-Manifest") == "true", b})
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	rows := make([]models.Metrics, 5)
+	for i := range rows {
+		rows[i] = models.Metrics{Date: "2025-08-01", Channel: "google_ads", CampaignID: fmt.Sprintf("C-%d", i)}
+	}
+	b := export.Batch{Seq: 3, From: "2025-08-01", To: "2025-08-01", Rows: rows}
+	s := export.NewHTTPSink(ingest.NewHTTPClient(2*time.Second), srv.URL, []signature.Key{{ID: "k", Secret: "s"}}, export.Format{Kind: "json"}).Chunked(2, 0)
+	if err := s.Write(context.Background(), b); err != nil {
+		t.Fatal(err)
+	}
+
+	key := export.IdempotencyKey(b)
+	if !strings.HasPrefix(key, "2025-08-01-") || strings.Contains(key, "-b3") {
+		t.Fatalf("key %q", key)
+	}
+	if len(got) != 4 {
+		t.Fatalf("requests %d, want 3 chunks + manifest", len(got))
+	}
+	var total int
+	for i, r := range got[:3] {
+		if r.key != fmt.Sprintf("%s-c%d", key, i+1) || r.chunk != fmt.Sprintf("%d/3", i+1) {
+			t.Fatalf("chunk %d: key=%q chunk=%q", i, r.key, r.chunk)
+		}
+		var part []models.Metrics
+		json.Unmarshal(r.body, &part)
+		total += len(part)
+	}
+	var m export.Manifest
+	if err := json.Unmarshal(got[3].body, &m); err != nil || !got[3].manifest || got[3].key != key+"-manifest" {
+		t.Fatalf("manifest: %+v err=%v", got[3], err)
+	}
+	if total != 5 || m.Rows != 5 || len(m.Chunks) != 3 || m.Chunks[2] != key+"-c3" {
+		t.Fatalf("manifest %+v, rows sent %d", m, total)
+	}
+
+	// mismo contenido => misma clave, aunque venga en otro lote; otro contenido => otra
+	b.Seq = 7
+	if export.IdempotencyKey(b) != key {
+		t.Fatal("key depends on the batch seq")
+	}
+	b.Rows = rows[:4]
+	if export.IdempotencyKey(b) == key {
+		t.Fatal("key ignores content")
+	}
+}
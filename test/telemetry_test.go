@@ -0,0 +1,33 @@
+package test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrometheusMetricsEndpoint(t *testing.T) {
+	h := newHarness(t, "it-secret")
+	h.do("POST", "/ingest/run", 202)
+	h.do("POST", "/export/run?date=2025-08-01", 200)
+	h.do("GET", "/export/jobs/X-1", 200)
+
+	out := string(h.do("GET", "/metrics", 200))
+	for _, want := range []string{
+		"# TYPE ingest_requests_total counter",
+		`ingest_requests_total{code="200",source="ads"}`,
+		`ingest_records_total{result="rejected",source="ads"}`,
+		`ingest_records_total{result="duplicate",source="ads"}`,
+		`ingest_records_total{result="accepted",source="crm"}`,
+		`ingest_latency_seconds_bucket{source="crm",le="+Inf"}`,
+		`export_attempts_total{outcome="delivered",sink="http"}`,
+		`export_rows_total{sink="http"}`,
+		"go_goroutines",
+		// ruta por patrón, no por path
+		`http_requests_total{code="200",method="GET",route="/export/jobs/{id}"}`,
+		`http_request_duration_seconds_count{code="202",method="POST",route="/ingest/run"}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s", want)
+		}
+	}
+}
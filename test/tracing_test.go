@@ -0,0 +1,170 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	coltrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/AngelCh415/ELT_GO/internal/ingest"
+	"github.com/AngelCh415/ELT_GO/internal/retry"
+	"github.com/AngelCh415/ELT_GO/internal/telemetry"
+)
+
+// collector hace de OTLP/HTTP (protobuf): guarda los spans de cada POST /v1/traces.
+type collector struct {
+	mu    sync.Mutex
+	spans map[string]map[string]any // span id → span
+}
+
+func newCollector(t *testing.T) (*collector, *httptest.Server) {
+	c := &collector{spans: map[string]map[string]any{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		var body coltrace.ExportTraceServiceRequest
+		if err := proto.Unmarshal(b, &body); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, rs := range body.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					id := hex.EncodeToString(s.SpanId)
+					c.spans[id] = map[string]any{
+						"name":         s.Name,
+						"traceId":      hex.EncodeToString(s.TraceId),
+						"spanId":       id,
+						"parentSpanId": hex.EncodeToString(s.ParentSpanId),
+					}
+				}
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return c, srv
+}
+
+func (c *collector) byName(name string) []map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []map[string]any
+	for _, s := range c.spans {
+		if s["name"] == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func TestTracingIngestAndExport(t *testing.T) {
+	col, srv := newCollector(t)
+	exp, err := telemetry.NewOTLPExporter(srv.URL, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := telemetry.NewTracer("elt-test", exp, 0)
+	defer tr.Shutdown(context.Background())
+
+	h := newHarness(t, "it-secret")
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest("POST", h.api.URL+"/ingest/run", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != 202 {
+		t.Fatalf("ingest: %v %v", err, resp)
+	}
+	resp.Body.Close()
+	if err := tr.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	root := col.byName("POST /ingest/run")
+	if len(root) != 1 || root[0]["traceId"] != traceID || root[0]["parentSpanId"] != "00f067aa0ba902b7" {
+		t.Fatalf("server span: %+v", root)
+	}
+	// la ingesta dispara ExportChanged, pero nada exportado cambió: sin envíos
+	for _, name := range []string{"etl.run", "ingest.fetch", "etl.normalize", "store.upsert", "HTTP GET"} {
+		spans := col.byName(name)
+		if len(spans) == 0 {
+			t.Fatalf("no %s span", name)
+		}
+		for _, s := range spans {
+			if s["traceId"] != traceID {
+				t.Fatalf("%s in trace %v", name, s["traceId"])
+			}
+			if _, ok := col.spans[s["parentSpanId"].(string)]; !ok {
+				t.Fatalf("%s parent %v not exported", name, s["parentSpanId"])
+			}
+		}
+	}
+	if n := len(col.byName("ingest.fetch")); n != 2 {
+		t.Fatalf("ingest.fetch spans = %d, want 2 (ads, crm)", n)
+	}
+
+	// export: span del ledger y request saliente al sink en la misma traza
+	h.do("POST", "/export/run?date=2025-08-01", 200)
+	tr.ForceFlush(context.Background())
+	send := col.byName("export.send")
+	if len(send) != 1 {
+		t.Fatalf("export.send spans: %+v", send)
+	}
+	var post map[string]any
+	for _, s := range col.byName("HTTP POST") {
+		if s["parentSpanId"] == send[0]["spanId"] {
+			post = s
+		}
+	}
+	if post == nil || post["traceId"] != send[0]["traceId"] {
+		t.Fatalf("sink POST not a child of export.send")
+	}
+}
+
+func TestTraceparentPropagationAndLogs(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("traceparent")
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	tr := telemetry.NewTracer("elt-test", nil, 0)
+	defer tr.Shutdown(context.Background())
+
+	var buf bytes.Buffer
+	log := slog.New(telemetry.LogHandler(slog.NewJSONHandler(&buf, nil)))
+	ctx, span := telemetry.StartSpan(context.Background(), "test", telemetry.KindInternal)
+	defer span.End()
+	log.InfoContext(ctx, "hello")
+
+	var dst []any
+	if err := ingest.GetJSONWithRetry(ctx, ingest.NewHTTPClient(2*time.Second), retry.Policy{}, "ads", srv.URL, &dst); err != nil {
+		t.Fatal(err)
+	}
+	id := span.SpanContext().TraceID().String()
+	if !strings.HasPrefix(got, "00-"+id+"-") || strings.Contains(got, span.SpanContext().SpanID().String()) {
+		t.Fatalf("traceparent %q: want trace %s with a child span id", got, id)
+	}
+	if !strings.Contains(buf.String(), `"trace_id":"`+id+`"`) {
+		t.Fatalf("log without trace_id: %s", buf.String())
+	}
+}